@@ -4,7 +4,13 @@
 // when game boards are rotated versions of each other.
 package game
 
-import "fmt"
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"strconv"
+	"strings"
+)
 
 // Symbol is used to represent whose turn it is, spaces on a game board,
 // and game outcomes.
@@ -48,15 +54,12 @@ func (s Symbol) String() string {
 }
 
 const BoardDim = 3
+const WinLength = 3 // number of symbols in a row needed to win, at most BoardDim
 const Rotations = 4 // number of times you can rotate a square board
 
 // normalizeRotations binds a number of rotations to the range 0-3.
 func normalizeRotations(rots int) int {
-	if rots < 0 {
-		return Rotations + (rots % Rotations)
-	} else {
-		return rots % Rotations
-	}
+	return (rots%Rotations + Rotations) % Rotations
 }
 
 // Position represents a space on a game board.
@@ -77,6 +80,94 @@ func (p Position) Valid() error {
 	return nil
 }
 
+// Add returns the position dr rows down and dc columns right of p.
+// The result is not checked against the bounds of the board; see Position.Valid.
+func (p Position) Add(dr, dc int) Position {
+	return Position{p.Row + dr, p.Col + dc}
+}
+
+// Direction is an orientation that a line on the board can run in.
+type Direction byte
+
+const (
+	Across       Direction = iota // along a row, left to right
+	Down                          // along a column, top to bottom
+	Diagonal                      // from the top left corner to the bottom right
+	AntiDiagonal                  // from the top right corner to the bottom left
+)
+
+// Directions lists every direction a line can run in.
+var Directions = [...]Direction{Across, Down, Diagonal, AntiDiagonal}
+
+// Delta returns the change in row and column for one step in the direction,
+// so that a line can be walked with p.Add(d.Delta()).
+func (d Direction) Delta() (dr, dc int) {
+	switch d {
+	case Across:
+		return 0, 1
+	case Down:
+		return 1, 0
+	case Diagonal:
+		return 1, 1
+	case AntiDiagonal:
+		return 1, -1
+	default:
+		return 0, 0
+	}
+}
+
+// lines lists every line on the board, for Board.Lines.
+var lines = func() [][WinLength]Position {
+	var ls [][WinLength]Position
+	for _, d := range Directions {
+		for r := range BoardDim {
+		starts:
+			for c := range BoardDim {
+				line := [WinLength]Position{{r, c}}
+				for i := 1; i < WinLength; i++ {
+					line[i] = line[i-1].Add(d.Delta())
+					if line[i].Valid() != nil {
+						continue starts
+					}
+				}
+				ls = append(ls, line)
+			}
+		}
+	}
+	return ls
+}()
+
+// ParsePosition reads a position from a row and column, given as "1 2", "1,2", or "12".
+// The position must be in bounds of the game board.
+func ParsePosition(s string) (Position, error) {
+	s = strings.TrimSpace(s)
+	var parts []string
+	switch {
+	case strings.Contains(s, ","):
+		parts = strings.Split(s, ",")
+	case strings.ContainsAny(s, " \t"):
+		parts = strings.Fields(s)
+	case len(s) == 2:
+		parts = []string{s[:1], s[1:]}
+	}
+	if len(parts) != 2 {
+		return Position{}, fmt.Errorf("position %q is not a row and column", s)
+	}
+	var coords [2]int
+	for i, part := range parts {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return Position{}, fmt.Errorf("position %q: %q is not a number", s, part)
+		}
+		coords[i] = n
+	}
+	p := Position{coords[0], coords[1]}
+	if err := p.Valid(); err != nil {
+		return Position{}, err
+	}
+	return p, nil
+}
+
 // Transform changes a position to follow a board transformed in the same way.
 // Rotations occur first, then transposition.
 func (p Position) Transform(rots int, transpose bool) Position {
@@ -98,6 +189,13 @@ func (p Position) Transform(rots int, transpose bool) Position {
 	return tp
 }
 
+// TransformInverse undoes Transform, so that p.Transform(rots, transpose)
+// .TransformInverse(rots, transpose) is p. Transposition is undone first,
+// then rotations.
+func (p Position) TransformInverse(rots int, transpose bool) Position {
+	return p.Transform(0, transpose).Transform(-rots, false)
+}
+
 // Board contains a grid of symbols as part of a game state.
 // It contains values of X, O, and Empty.
 //
@@ -117,6 +215,52 @@ func (b Board) String() string {
 	return s + "]"
 }
 
+// ParseBoard reads a board in row-major order from a string of X, O, and . symbols,
+// such as the output of Board.String ("[X.. .O. ...]"). Letters may be lowercase,
+// and brackets, spaces, and slashes between rows are ignored.
+func ParseBoard(s string) (Board, error) {
+	var (
+		b     Board
+		cells []Symbol
+	)
+	for _, ch := range strings.ToUpper(s) {
+		switch ch {
+		case 'X':
+			cells = append(cells, X)
+		case 'O':
+			cells = append(cells, O)
+		case '.':
+			cells = append(cells, Empty)
+		case '[', ']', '/', ' ', '\t', '\n', '\r':
+		default:
+			return Board{}, fmt.Errorf("board %q: invalid symbol %q", s, ch)
+		}
+	}
+	if len(cells) != BoardDim*BoardDim {
+		return Board{}, fmt.Errorf("board %q has %d spaces, not %d", s, len(cells), BoardDim*BoardDim)
+	}
+	for i, cell := range cells {
+		b[i/BoardDim][i%BoardDim] = cell
+	}
+	return b, nil
+}
+
+// BoardOf creates a board from its spaces in row-major order, so that
+// index 4 is the center. Every space must be X, O, or Empty.
+func BoardOf(cells ...Symbol) (Board, error) {
+	var b Board
+	if len(cells) != BoardDim*BoardDim {
+		return Board{}, fmt.Errorf("board has %d spaces, not %d", len(cells), BoardDim*BoardDim)
+	}
+	for i, cell := range cells {
+		if cell != Empty && !cell.Player() {
+			return Board{}, fmt.Errorf("space %v: invalid symbol %v", PositionFromBit(i), cell)
+		}
+		b[i/BoardDim][i%BoardDim] = cell
+	}
+	return b, nil
+}
+
 // Pretty returns a multi-line representation of the game state.
 func (b Board) Pretty() string {
 	s := ""
@@ -129,6 +273,43 @@ func (b Board) Pretty() string {
 	return s
 }
 
+// PrettyTransforms returns a multi-line representation of all 8 transformations
+// of the board side by side, each labeled with the (rotations, transposed)
+// arguments to Board.Transform that produce it. The first row has the rotations
+// alone, and the second has the same rotations followed by transposition.
+func (b Board) PrettyTransforms() string {
+	var (
+		sb    strings.Builder
+		width = len("(0, false)")
+	)
+	for i, transpose := range [...]bool{false, true} {
+		if i > 0 {
+			sb.WriteByte('\n')
+		}
+		// The label, then the rows of the board, for each number of rotations.
+		var rows [BoardDim + 1][Rotations]string
+		for rots := range Rotations {
+			tb := b.Transform(rots, transpose)
+			rows[0][rots] = fmt.Sprintf("(%d, %t)", rots, transpose)
+			for r := range BoardDim {
+				for c := range BoardDim {
+					rows[r+1][rots] += tb[r][c].String()
+				}
+			}
+		}
+		for _, row := range rows {
+			for rots, cell := range row {
+				if rots < Rotations-1 {
+					cell = fmt.Sprintf("%-*s  ", width, cell)
+				}
+				sb.WriteString(cell)
+			}
+			sb.WriteByte('\n')
+		}
+	}
+	return sb.String()
+}
+
 // Space returns the symbol at the given position.
 // Equivalent to unchecked b[p.Row][p.Col].
 func (b *Board) Space(p Position) (*Symbol, error) {
@@ -138,71 +319,171 @@ func (b *Board) Space(p Position) (*Symbol, error) {
 	return &b[p.Row][p.Col], nil
 }
 
-// Rotate turns and/or mirrors a board over the top-left to bottom-right diagonal.
-// Rotations occur first, then transposition.
-func (b Board) Transform(rots int, transpose bool) Board {
-	rots = normalizeRotations(rots)
-	var tb Board
-	switch rots {
-	case 1:
-		for r := range BoardDim {
-			for c := range BoardDim {
-				tb[r][c] = b[BoardDim-c-1][r]
-			}
-		}
-	case 2:
-		for r := range BoardDim {
-			for c := range BoardDim {
-				tb[r][c] = b[BoardDim-r-1][BoardDim-c-1]
-			}
-		}
-	case 3:
-		for r := range BoardDim {
-			for c := range BoardDim {
-				tb[r][c] = b[c][BoardDim-r-1]
+// Diff collects the positions where this board and another board
+// have different symbols, in row-major order. For consecutive game states,
+// this is the single move that was made.
+func (b Board) Diff(other Board) []Position {
+	var diff []Position
+	for r := range BoardDim {
+		for c := range BoardDim {
+			if b[r][c] != other[r][c] {
+				diff = append(diff, Position{r, c})
 			}
 		}
-	default:
-		for r := range BoardDim {
-			for c := range BoardDim {
-				tb[r][c] = b[r][c]
+	}
+	return diff
+}
+
+// Lines returns every line of WinLength spaces that wins the game when filled
+// by one player: those running across, then down, then diagonally, then
+// anti-diagonally, each in row-major order of their first space. When WinLength
+// is BoardDim, these are each row, each column, and both diagonals.
+func (b Board) Lines() [][WinLength]Position {
+	return slices.Clone(lines)
+}
+
+// transformSources holds, for each transformation, the space in the original board
+// that each space in the transformed board comes from, so that boards can be
+// transformed with a single pass. Transformations are indexed by rotations,
+// then 1 if transposed.
+var transformSources = func() (sources [Rotations][2][BoardDim][BoardDim]Position) {
+	for rots := range Rotations {
+		for t, transpose := range [...]bool{false, true} {
+			for r := range BoardDim {
+				for c := range BoardDim {
+					sources[rots][t][r][c] = Position{r, c}.TransformInverse(rots, transpose)
+				}
 			}
 		}
 	}
+	return sources
+}()
+
+// Rotate turns and/or mirrors a board over the top-left to bottom-right diagonal.
+// Rotations occur first, then transposition.
+func (b Board) Transform(rots int, transpose bool) Board {
+	t := 0
 	if transpose {
-		for r := range BoardDim {
-			for c := range r {
-				tb[r][c], tb[c][r] = tb[c][r], tb[r][c]
-			}
+		t = 1
+	}
+	return b.transformFrom(&transformSources[normalizeRotations(rots)][t])
+}
+
+// transformFrom transforms the board by a table from transformSources.
+func (b Board) transformFrom(sources *[BoardDim][BoardDim]Position) Board {
+	var tb Board
+	for r := range BoardDim {
+		for c := range BoardDim {
+			p := sources[r][c]
+			tb[r][c] = b[p.Row][p.Col]
 		}
 	}
 	return tb
 }
 
+// TransformInverse undoes Transform, so that b.Transform(rots, transpose)
+// .TransformInverse(rots, transpose) is b. Transposition is undone first,
+// then rotations.
+func (b Board) TransformInverse(rots int, transpose bool) Board {
+	return b.Transform(0, transpose).Transform(-rots, false)
+}
+
 // Transformation tests if a board is a transformation of another board
 // by transposition and rotation. Returns the rotations and transformations
 // (in that order) on the other board needed to produce this one.
 // If ok is false, the boards are not related.
 func (b Board) Transformation(other Board) (rots int, transposed bool, ok bool) {
-	// Test all combinations of rotations and transpositions (8).
+	// Test all combinations of rotations and transpositions (8), comparing spaces
+	// as they are transformed so that most mismatches are found after a few spaces.
 	for rots := range Rotations {
-		rb := other.Transform(rots, false)
-		if rb == b {
-			return rots, false, true
-		}
-		trb := other.Transform(rots, true)
-		if trb == b {
-			return rots, true, true
+	transforms:
+		for t, transpose := range [...]bool{false, true} {
+			sources := &transformSources[rots][t]
+			for r := range BoardDim {
+				for c := range BoardDim {
+					if p := sources[r][c]; other[p.Row][p.Col] != b[r][c] {
+						continue transforms
+					}
+				}
+			}
+			return rots, transpose, true
 		}
 	}
 	return 0, false, false
 }
 
+// Canonical returns the representative of the board's transformations,
+// which is the same for every board that is a transformation of this one.
+// The representative is the transformation that comes first when comparing
+// symbols in row-major order.
+func (b Board) Canonical() Board {
+	// Find the first transformation without building each transformed board,
+	// since most comparisons are decided after a few spaces.
+	canon := &transformSources[0][0]
+	for rots := range Rotations {
+		for t := range 2 {
+			if sources := &transformSources[rots][t]; b.lessUnder(sources, canon) {
+				canon = sources
+			}
+		}
+	}
+	return b.transformFrom(canon)
+}
+
+// lessUnder compares the board transformed by two tables from transformSources,
+// by their symbols in row-major order.
+func (b Board) lessUnder(sources, other *[BoardDim][BoardDim]Position) bool {
+	for r := range BoardDim {
+		for c := range BoardDim {
+			p, q := sources[r][c], other[r][c]
+			if s, o := b[p.Row][p.Col], b[q.Row][q.Col]; s != o {
+				return s < o
+			}
+		}
+	}
+	return false
+}
+
+// CanonicalBoards collects the canonical board (see Board.Canonical) of every
+// game state that can be reached by legal play, including completed games.
+// These are the boards MENACE needs a box for.
+//
+// Boards are ordered by the number of symbols on them, then in the order
+// they are found by playing each legal move in row-major order.
+func CanonicalBoards() []Board {
+	var (
+		layer  = []Game{New()}
+		seen   = map[Board]bool{{}: true}
+		boards = []Board{{}}
+	)
+	for len(layer) > 0 {
+		var next []Game
+		for _, g := range layer {
+			for _, mv := range g.Moves() {
+				ng, err := g.Move(mv)
+				if err != nil {
+					panic("illegal move came from Game.Moves()")
+				}
+				canon := ng.board.Canonical()
+				if seen[canon] {
+					continue
+				}
+				seen[canon] = true
+				boards = append(boards, canon)
+				next = append(next, ng)
+			}
+		}
+		layer = next
+	}
+	return boards
+}
+
 // Game represents an ongoing or completed game of Tic-Tac-Toe.
 // The zero-value has an invalid value of Empty for turn and cannot be played.
 type Game struct {
-	board Board
-	turn  Symbol
+	board  Board
+	turn   Symbol
+	winner Symbol // outcome of board, found once when the game is created
 }
 
 // New creates a game with an empty board where it is X's turn.
@@ -210,11 +491,34 @@ func New() Game {
 	return Game{turn: X}
 }
 
+// FromBoard creates a game with the given board, where it is the turn of
+// the player who has made fewer moves (X if they have made the same number).
+//
+// Returns an error if the board cannot be reached by legal play from an empty board.
+func FromBoard(b Board) (Game, error) {
+	orders, err := b.InferMoves()
+	if err != nil {
+		return Game{}, err
+	}
+	turn := X
+	if len(orders[0])%2 == 1 {
+		turn = O
+	}
+	return Game{board: b, turn: turn, winner: b.winner()}, nil
+}
+
 // Board returns the board state for this game.
 func (g Game) Board() Board {
 	return g.board
 }
 
+// BoxKey returns the canonical board for the game state (see Board.Canonical),
+// which is the same for every game state that is a transformation of this one,
+// however it was reached. MENACE keys its boxes by this board.
+func (g Game) BoxKey() Board {
+	return g.board.Canonical()
+}
+
 // Turn returns the player whose turn it is. For valid game
 // states, will be X or O.
 func (g Game) Turn() Symbol {
@@ -241,61 +545,18 @@ func (g Game) Pretty() string {
 // Winner checks for a winner.
 // Returns X or O if those players have made a line of their symbol.
 // Returns Empty if the game is still going, and Cat if the game is a draw.
+//
+// The outcome is found once when the game is created, so checking it is cheap.
 func (g Game) Winner() Symbol {
-	b := g.board
+	return g.winner
+}
+
+// winner finds the outcome of a board for Game.Winner.
+func (b Board) winner() Symbol {
 	// Check for lines.
-rowCheck:
-	for r := range BoardDim {
-		check := b[r][0]
-		if !check.Player() {
-			continue
-		}
-		for c := 1; c < BoardDim; c++ {
-			if b[r][c] != check {
-				continue rowCheck
-			}
-		}
-		return check
-	}
-colCheck:
-	for c := range BoardDim {
-		check := b[0][c]
-		if !check.Player() {
-			continue
-		}
-		for r := 1; r < BoardDim; r++ {
-			if b[r][c] != check {
-				continue colCheck
-			}
-		}
-		return check
-	}
-	// Diagonals.
-	var check Symbol
-	check = b[0][0]
-	if check.Player() {
-		complete := true
-		for i := 1; i < BoardDim; i++ {
-			if b[i][i] != check {
-				complete = false
-				break
-			}
-		}
-		if complete {
-			return check
-		}
-	}
-	check = b[0][BoardDim-1]
-	if check.Player() {
-		complete := true
-		for i := 1; i < BoardDim; i++ {
-			if b[i][BoardDim-i-1] != check {
-				complete = false
-				break
-			}
-		}
-		if complete {
-			return check
+	for _, line := range lines {
+		if w := b.lineOwner(line); w != Empty {
+			return w
 		}
 	}
 	// Check for filled board.
@@ -310,12 +571,62 @@ colCheck:
 	return Cat
 }
 
+// lineOwner returns the player who fills the whole line, or Empty if no player does.
+func (b Board) lineOwner(line [WinLength]Position) Symbol {
+	check := b[line[0].Row][line[0].Col]
+	if !check.Player() {
+		return Empty
+	}
+	for _, p := range line[1:] {
+		if b[p.Row][p.Col] != check {
+			return Empty
+		}
+	}
+	return check
+}
+
+// Rule decides how a line of symbols is interpreted.
+type Rule byte
+
+const (
+	Standard Rule = iota // making a line wins
+	Misere               // making a line loses (anti-tic-tac-toe)
+)
+
+// WinnerWithRule checks for a winner like Winner, but under the given rule.
+// In misère play, the player who makes a line is the loser.
+func (g Game) WinnerWithRule(r Rule) Symbol {
+	w := g.Winner()
+	if r == Misere {
+		return w.Other()
+	}
+	return w
+}
+
 // Completed checks whether the game is complete.
 // Equivalent to g.Winner() != Empty.
 func (g Game) Completed() bool {
 	return g.Winner() != Empty
 }
 
+// IsDead checks whether neither player can make a line, because every line
+// already has both an X and an O in it. A dead game is certain to be a draw,
+// even if there are empty spaces left.
+func (g Game) IsDead() bool {
+	b := g.board
+	for _, line := range lines {
+		var hasX, hasO bool
+		for _, p := range line {
+			hasX = hasX || b[p.Row][p.Col] == X
+			hasO = hasO || b[p.Row][p.Col] == O
+		}
+		if !hasX || !hasO {
+			return false
+		}
+	}
+	return true
+}
+
 // SpacesFilled returns the number of spaces with an X or O in it.
 func (g Game) SpacesFilled() int {
 	s := 0
@@ -361,6 +672,31 @@ func (g Game) Moves() []Position {
 	return spaces
 }
 
+// MovesMask collects empty spaces on the game board like Moves, but without
+// allocating. Bit i of the mask is set if the position PositionFromBit(i) is empty.
+//
+// Returns 0 if the game is not playable in this state.
+func (g Game) MovesMask() uint16 {
+	if err := g.Playable(); err != nil {
+		return 0
+	}
+	var mask uint16
+	for r := range BoardDim {
+		for c := range BoardDim {
+			if g.board[r][c] == Empty {
+				mask |= 1 << (r*BoardDim + c)
+			}
+		}
+	}
+	return mask
+}
+
+// PositionFromBit returns the position represented by bit i of a mask
+// from Game.MovesMask. Positions are numbered in row-major order.
+func PositionFromBit(i int) Position {
+	return Position{i / BoardDim, i % BoardDim}
+}
+
 // Move creates a new game state with a symbol placed in the
 // specified position and the turn switched.
 func (g Game) Move(mv Position) (Game, error) {
@@ -376,5 +712,71 @@ func (g Game) Move(mv Position) (Game, error) {
 	}
 	*s = g.turn
 	g.turn = g.turn.Other()
+	g.winner = g.board.winner()
 	return g, nil
 }
+
+// RandomGame plays a random number of random legal moves from a new game,
+// up to maxMoves, and stops early if the game is completed. This produces
+// arbitrary reachable game states, such as for testing.
+//
+// Random choices come from r, or from the shared source in math/rand if r is nil.
+func RandomGame(r *rand.Rand, maxMoves int) Game {
+	pick := rand.Intn
+	if r != nil {
+		pick = r.Intn
+	}
+	var (
+		g = New()
+		n = pick(min(max(maxMoves, 0), BoardDim*BoardDim) + 1)
+	)
+	for range n {
+		moves := g.Moves()
+		if len(moves) == 0 {
+			break
+		}
+		next, err := g.Move(moves[pick(len(moves))])
+		if err != nil {
+			panic("illegal move came from Game.Moves()")
+		}
+		g = next
+	}
+	return g
+}
+
+// InferMoves finds every alternating sequence of moves, starting with X,
+// that produces this board from an empty one. Sequences where the game ends
+// before the last move are excluded.
+//
+// An empty board produces a single empty sequence. Returns an error if no
+// sequence of legal moves produces the board.
+func (b Board) InferMoves() ([][]Position, error) {
+	var (
+		orders [][]Position
+		order  []Position
+		search func(g Game)
+	)
+	search = func(g Game) {
+		if g.board == b {
+			orders = append(orders, append([]Position(nil), order...))
+			return
+		}
+		for _, mv := range g.Moves() {
+			if b[mv.Row][mv.Col] != g.turn {
+				continue
+			}
+			next, err := g.Move(mv)
+			if err != nil {
+				panic("illegal move came from Game.Moves()")
+			}
+			order = append(order, mv)
+			search(next)
+			order = order[:len(order)-1]
+		}
+	}
+	search(New())
+	if len(orders) == 0 {
+		return nil, fmt.Errorf("board %v cannot be reached by legal play", b)
+	}
+	return orders, nil
+}
@@ -0,0 +1,106 @@
+package game
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// jsonSymbol returns the JSON string for a symbol on a board or a turn.
+// Empty spaces are represented by the empty string.
+func jsonSymbol(s Symbol) string {
+	if s == Empty {
+		return ""
+	}
+	return s.String()
+}
+
+// parseJSONSymbol reverses jsonSymbol for the symbols allowed on a board.
+func parseJSONSymbol(s string) (Symbol, error) {
+	switch s {
+	case "":
+		return Empty, nil
+	case "X":
+		return X, nil
+	case "O":
+		return O, nil
+	default:
+		return Empty, fmt.Errorf("invalid symbol %q", s)
+	}
+}
+
+// MarshalJSON encodes a board as a 3x3 array of rows, where each space
+// is "X", "O", or "" for an empty space.
+//
+//	[["X", "", ""], ["", "O", ""], ["", "", ""]]
+func (b Board) MarshalJSON() ([]byte, error) {
+	var rows [BoardDim][BoardDim]string
+	for r := range BoardDim {
+		for c := range BoardDim {
+			rows[r][c] = jsonSymbol(b[r][c])
+		}
+	}
+	return json.Marshal(rows)
+}
+
+// UnmarshalJSON decodes a board in the format described by MarshalJSON.
+func (b *Board) UnmarshalJSON(data []byte) error {
+	var rows [BoardDim][BoardDim]string
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return err
+	}
+	for r := range BoardDim {
+		for c := range BoardDim {
+			s, err := parseJSONSymbol(rows[r][c])
+			if err != nil {
+				return fmt.Errorf("space %v: %w", Position{r, c}, err)
+			}
+			b[r][c] = s
+		}
+	}
+	return nil
+}
+
+// jsonGame is the JSON shape of a Game.
+type jsonGame struct {
+	Board Board  `json:"board"`
+	Turn  string `json:"turn"`
+}
+
+// MarshalJSON encodes a game as an object with its board (see Board.MarshalJSON)
+// and the player whose turn it is, "X" or "O".
+//
+//	{"board": [["X", "", ""], ["", "", ""], ["", "", ""]], "turn": "O"}
+func (g Game) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonGame{g.board, jsonSymbol(g.turn)})
+}
+
+// UnmarshalJSON decodes a game in the format described by MarshalJSON.
+// Returns an error if the turn is not "X" or "O".
+func (g *Game) UnmarshalJSON(data []byte) error {
+	var jg jsonGame
+	if err := json.Unmarshal(data, &jg); err != nil {
+		return err
+	}
+	turn, err := parseJSONSymbol(jg.Turn)
+	if err != nil || !turn.Player() {
+		return fmt.Errorf("invalid turn %q", jg.Turn)
+	}
+	*g = Game{board: jg.Board, turn: turn, winner: jg.Board.winner()}
+	return nil
+}
+
+// MarshalText encodes a position as "row,col", so that positions
+// can be used as JSON object keys.
+func (p Position) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// UnmarshalText decodes a position in any format accepted by ParsePosition.
+func (p *Position) UnmarshalText(text []byte) error {
+	pos, err := ParsePosition(string(text))
+	if err != nil {
+		return err
+	}
+	*p = pos
+	return nil
+}
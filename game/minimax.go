@@ -0,0 +1,145 @@
+package game
+
+import "sync"
+
+// values caches the outcome of perfect play from each game state.
+var values = struct {
+	sync.Mutex
+	m map[Game]Symbol
+}{m: make(map[Game]Symbol)}
+
+// Value returns the outcome of the game if both players play perfectly
+// from this state: X or O if that player can force a win, or Cat for a draw.
+// Completed games return their winner.
+//
+// Returns Empty if the turn is in a bad state (not X or O).
+// Values follow the Standard rule.
+func (g Game) Value() Symbol {
+	if g.Completed() {
+		return g.Winner()
+	}
+	if !g.turn.Player() {
+		return Empty
+	}
+	values.Lock()
+	v, ok := values.m[g]
+	values.Unlock()
+	if ok {
+		return v
+	}
+	// Assume a loss until a better move is found.
+	v = g.turn.Other()
+moves:
+	for _, mv := range g.Moves() {
+		next, err := g.Move(mv)
+		if err != nil {
+			panic("illegal move came from Game.Moves()")
+		}
+		switch next.Value() {
+		case g.turn:
+			v = g.turn
+			break moves
+		case Cat:
+			v = Cat
+		}
+	}
+	values.Lock()
+	values.m[g] = v
+	values.Unlock()
+	return v
+}
+
+// BestMoves collects the moves that keep the best outcome available to the
+// player whose turn it is, meaning the resulting game has the same Value.
+//
+// Returns empty if the game is not playable in this state.
+func (g Game) BestMoves() []Position {
+	var (
+		v    = g.Value()
+		best []Position
+	)
+	for _, mv := range g.Moves() {
+		next, err := g.Move(mv)
+		if err != nil {
+			panic("illegal move came from Game.Moves()")
+		}
+		if next.Value() == v {
+			best = append(best, mv)
+		}
+	}
+	return best
+}
+
+// noWin is the distance from a game state where a player cannot force a win.
+const noWin = BoardDim*BoardDim + 1
+
+// ShortestWin finds the fewest moves in which player s can force a win from
+// this state, however the other player responds. It also returns a principal
+// variation: the moves of both players in a game where s wins in that many moves,
+// while the other player holds out as long as possible. Where several moves are
+// equally good, the earliest in row-major order is chosen.
+//
+// If s cannot force a win, ok is false. A completed game that s has won
+// is a win in 0 moves. Wins follow the Standard rule.
+func (g Game) ShortestWin(s Symbol) (moves int, line []Position, ok bool) {
+	memo := make(map[Game]int)
+	moves = g.winDistance(s, memo)
+	if moves >= noWin {
+		return 0, nil, false
+	}
+	for gm := g; !gm.Completed(); {
+		// Follow a move that keeps the distance, which for s is the quickest win,
+		// and for the other player is the longest defense.
+		want := gm.winDistance(s, memo)
+		if gm.turn == s {
+			want--
+		}
+		for _, mv := range gm.Moves() {
+			next, err := gm.Move(mv)
+			if err != nil {
+				panic("illegal move came from Game.Moves()")
+			}
+			if next.winDistance(s, memo) == want {
+				line = append(line, mv)
+				gm = next
+				break
+			}
+		}
+	}
+	return moves, line, true
+}
+
+// winDistance finds the fewest moves in which s can force a win for ShortestWin,
+// or noWin if s cannot. Distances are memoized in memo.
+func (g Game) winDistance(s Symbol, memo map[Game]int) int {
+	if d, ok := memo[g]; ok {
+		return d
+	}
+	var d int
+	switch {
+	case g.Completed():
+		d = noWin
+		if g.Winner() == s {
+			d = 0
+		}
+	case g.turn == s:
+		d = noWin
+		for _, mv := range g.Moves() {
+			next, err := g.Move(mv)
+			if err != nil {
+				panic("illegal move came from Game.Moves()")
+			}
+			d = min(d, 1+next.winDistance(s, memo))
+		}
+	default:
+		for _, mv := range g.Moves() {
+			next, err := g.Move(mv)
+			if err != nil {
+				panic("illegal move came from Game.Moves()")
+			}
+			d = max(d, next.winDistance(s, memo))
+		}
+	}
+	memo[g] = d
+	return d
+}
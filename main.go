@@ -1,15 +1,27 @@
 package main
 
 import (
+	"bufio"
+	"cmp"
+	"context"
+	"encoding/json"
 	"fmt"
 	"log"
-	"math/rand"
+	"maps"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/adambyle/menace/game"
 	"github.com/adambyle/menace/menace"
 )
 
+// stdin is shared by all input so that buffered input isn't lost between reads.
+var stdin = bufio.NewReader(os.Stdin)
+
 func main() {
 	m := menace.Default()
 	fmt.Println("MENACE simulator")
@@ -19,179 +31,550 @@ main:
 		fmt.Println("\nChoose mode:")
 		fmt.Println("X: Play against human (You are X)")
 		fmt.Println("O: Play against human (You are O)")
+		fmt.Println("G: Resume a saved game against human")
 		fmt.Println("T: Train against self")
 		fmt.Println("B: Train against random-player")
+		fmt.Println("H: Train against heuristic-player")
+		fmt.Println("P: Train against perfect-player")
+		fmt.Println("V: Watch MENACE play itself")
+		fmt.Println("A: Analyze a position")
+		fmt.Println("K: Show MENACE's opening moves")
+		fmt.Println("S: Save MENACE to a file")
+		fmt.Println("L: Load MENACE from a file")
+		fmt.Println("C: Configure and reset")
 		fmt.Println("R: Reset")
 		fmt.Println("Q: Quit")
-		var choice string
-		fmt.Scanln(&choice)
+		choice, ok := readLine()
+		if !ok {
+			break main
+		}
 		switch strings.ToLower(choice) {
 		case "q":
 			break main
 		case "x":
-			play(&m, game.O)
+			play(&m, game.O, nil)
 		case "o":
-			play(&m, game.X)
+			play(&m, game.X, nil)
+		case "g":
+			fmt.Println("Resume from which file?")
+			path, ok := readLine()
+			if !ok {
+				break main
+			}
+			sg, err := loadGameFile(path)
+			if err != nil {
+				fmt.Println("Load failed:", err)
+				continue
+			}
+			play(&m, sg.MenaceSide, sg.Replay)
 		case "t":
-			var count int
-			fmt.Println("How many games?")
-			fmt.Scanln(&count)
-			train(&m, count)
+			count, save, ok := readTraining()
+			if !ok {
+				break main
+			}
+			train(&m, count, save)
 		case "b":
-			var count int
-			fmt.Println("How many games?")
-			fmt.Scanln(&count)
-			trainRandom(&m, count)
+			count, save, ok := readTraining()
+			if !ok {
+				break main
+			}
+			trainAgainst(&m, menace.RandomOpponent{}, count, save)
+		case "h":
+			count, save, ok := readTraining()
+			if !ok {
+				break main
+			}
+			trainAgainst(&m, menace.HeuristicOpponent{}, count, save)
+		case "p":
+			count, save, ok := readTraining()
+			if !ok {
+				break main
+			}
+			trainAgainst(&m, menace.MinimaxOpponent{}, count, save)
+		case "v":
+			count, ok := readInt("How many games?")
+			if !ok {
+				break main
+			}
+			fmt.Println("Always play the move with the most beads? (y/n)")
+			greedy, ok := readLine()
+			if !ok {
+				break main
+			}
+			for range count {
+				spectate(m, strings.ToLower(greedy) == "y")
+			}
+		case "a":
+			analyze(m)
+		case "k":
+			openingBook(m)
+		case "s":
+			fmt.Println("Save to which file?")
+			path, ok := readLine()
+			if !ok {
+				break main
+			}
+			if err := saveFile(m, path); err != nil {
+				fmt.Println("Save failed:", err)
+			} else {
+				fmt.Println("Saved to", path)
+			}
+		case "l":
+			fmt.Println("Load from which file?")
+			path, ok := readLine()
+			if !ok {
+				break main
+			}
+			loaded, err := loadFile(path)
+			if err != nil {
+				fmt.Println("Load failed:", err)
+			} else {
+				m = loaded
+				fmt.Println("Loaded from", path)
+			}
+		case "c":
+			if !configure(&m) {
+				break main
+			}
 		case "r":
 			m = menace.Default()
 		}
 	}
 }
 
-type moves = map[game.Game]game.Position
+// autosave controls saving MENACE to a file periodically during training.
+type autosave struct {
+	every int // games between saves, or 0 for never
+	path  string
+}
+
+// readLine reads a line of input, without surrounding whitespace.
+// Returns false if there is no more input.
+func readLine() (string, bool) {
+	line, err := stdin.ReadString('\n')
+	if err != nil && line == "" {
+		return "", false
+	}
+	return strings.TrimSpace(line), true
+}
+
+// readInt shows a prompt and reads a whole number of 0 or more,
+// prompting again until one is entered. Returns false if there is no more input.
+func readInt(prompt string) (int, bool) {
+	for {
+		fmt.Println(prompt)
+		line, ok := readLine()
+		if !ok {
+			return 0, false
+		}
+		if n, err := strconv.Atoi(line); err == nil && n >= 0 {
+			return n, true
+		}
+		fmt.Println("Please enter a whole number of 0 or more.")
+	}
+}
+
+// readOption shows a prompt with the current value of an option, and reads
+// a new whole number, or keeps the current value if the line is blank.
+// Returns false if there is no more input.
+func readOption(prompt string, current int) (int, bool) {
+	for {
+		fmt.Printf("%v (currently %d, blank to keep):\n", prompt, current)
+		line, ok := readLine()
+		if !ok {
+			return 0, false
+		}
+		if line == "" {
+			return current, true
+		}
+		if n, err := strconv.Atoi(line); err == nil {
+			return n, true
+		}
+		fmt.Println("Please enter a whole number.")
+	}
+}
+
+// readTraining asks how many games to train for, and how often to autosave.
+// Returns false if there is no more input.
+func readTraining() (count int, save autosave, ok bool) {
+	if count, ok = readInt("How many games?"); !ok {
+		return
+	}
+	if save.every, ok = readInt("Autosave every how many games? (0 for never)"); !ok {
+		return
+	}
+	if save.every > 0 {
+		fmt.Println("Autosave to which file?")
+		save.path, ok = readLine()
+	}
+	return
+}
 
-func train(m *menace.Menace, count int) {
-games:
+// runTraining plays count training games with playOne, reporting progress
+// and autosaving along the way. Training stops early if playOne returns false.
+func runTraining(m *menace.Menace, count int, save autosave, playOne func(i int) bool) {
 	for i := range count {
-		var (
-			gm  = game.New()
-			mvs = map[game.Symbol]moves{
-				game.X: {},
-				game.O: {},
-			}
-		)
-		for !gm.Completed() {
-			mv, next, moved, err := m.Move(gm)
-			if err != nil {
-				log.Fatal("training failure:", err)
-			}
-			if !moved {
-				// MENACE resigned.
-				m.Punish(mvs[gm.Turn()])
-				continue games
-			}
-			mvs[gm.Turn()][gm] = mv
-			gm = next
+		if !playOne(i) {
+			fmt.Println("Training interrupted after", i, "games")
+			return
 		}
 		if (i+1)%5000 == 0 {
 			fmt.Println(i+1, "games done")
 		}
-		if gm.Winner() == game.Cat {
-			m.Reward(mvs[gm.Winner()], false)
-			m.Reward(mvs[gm.Winner().Other()], false)
-			continue
+		if save.every > 0 && (i+1)%save.every == 0 {
+			if err := saveFile(*m, save.path); err != nil {
+				fmt.Println("Autosave failed:", err)
+			} else {
+				fmt.Println("Autosaved to", save.path)
+			}
 		}
-		m.Reward(mvs[gm.Winner()], true)
-		m.Punish(mvs[gm.Winner().Other()])
 	}
 	fmt.Println("Training done!")
 }
 
-func trainRandom(m *menace.Menace, count int) {
+func train(m *menace.Menace, count int, save autosave) {
+	// Stop training cleanly on Ctrl-C.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	runTraining(m, count, save, func(int) bool {
+		return m.TrainSelfContext(ctx, 1) == 1
+	})
+}
+
+// trainAgainst trains MENACE against an opponent, alternating which side MENACE plays.
+func trainAgainst(m *menace.Menace, opp menace.Opponent, count int, save autosave) {
 	turn := game.X
-	for i := range count {
-		trainOnce(m, turn)
+	runTraining(m, count, save, func(int) bool {
+		if err := m.TrainAgainst(opp, 1, turn, false); err != nil {
+			fmt.Println("Training failed:", err)
+			return false
+		}
 		turn = turn.Other()
-		if (i+1)%5000 == 0 {
-			fmt.Println(i+1, "games done")
+		return true
+	})
+}
+
+// configure asks for new options, starting from MENACE's current ones, and replaces
+// MENACE with a new instance using them. If the options are invalid, MENACE is kept.
+// Returns false if there is no more input.
+func configure(m *menace.Menace) bool {
+	options := m.Options()
+	fmt.Println("New options reset MENACE's training.")
+	var ok bool
+	if options.WinReward, ok = readOption("Beads added for wins", options.WinReward); !ok {
+		return false
+	}
+	if options.DrawReward, ok = readOption("Beads added for draws, or removed if negative", options.DrawReward); !ok {
+		return false
+	}
+	for {
+		fmt.Printf("Starting beads per move for each layer (currently %v, blank to keep):\n",
+			strings.Trim(fmt.Sprint(options.Beads), "[]"))
+		line, ok := readLine()
+		if !ok {
+			return false
+		}
+		if line == "" {
+			break
+		}
+		if beads, err := parseBeads(line); err != nil {
+			fmt.Println("Invalid beads:", err)
+		} else {
+			options.Beads = beads
+			break
 		}
 	}
+	configured, err := menace.New(options)
+	if err != nil {
+		fmt.Println("Invalid options:", err)
+		return true
+	}
+	*m = configured
+	fmt.Println("MENACE reset with new options")
+	return true
 }
 
-func trainOnce(m *menace.Menace, turn game.Symbol) {
-	var (
-		gm  = game.New()
-		mvs = make(moves)
-	)
-	for !gm.Completed() {
-		if gm.Turn() == turn {
-			mv, next, moved, err := m.Move(gm)
-			if err != nil {
-				log.Fatal("training failure:", err)
-			}
-			if !moved {
-				// MENACE resigned.
-				m.Punish(mvs)
-				return
-			}
-			mvs[gm] = mv
-			gm = next
-		} else {
-			var (
-				valid = gm.Moves()
-				mi    = rand.Intn(len(valid))
-				mv    = valid[mi]
-			)
-			next, err := gm.Move(mv)
-			if err != nil {
-				panic("valid move not valid")
-			}
-			gm = next
+// parseBeads reads the starting beads for each layer, separated by spaces.
+func parseBeads(s string) (beads [len(menace.Options{}.Beads)]int, err error) {
+	fields := strings.Fields(s)
+	if len(fields) != len(beads) {
+		return beads, fmt.Errorf("expected %d numbers, got %d", len(beads), len(fields))
+	}
+	for i, field := range fields {
+		if beads[i], err = strconv.Atoi(field); err != nil {
+			return beads, err
+		}
+	}
+	return beads, nil
+}
+
+// saveFile saves MENACE to the file at path, replacing it if it exists.
+func saveFile(m menace.Menace, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := m.Save(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// loadFile loads MENACE from the file at path.
+func loadFile(path string) (menace.Menace, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return menace.Menace{}, err
+	}
+	defer f.Close()
+	return menace.Load(f)
+}
+
+// savedGame is a game between the user and MENACE, saved partway through
+// so that it can be resumed later.
+type savedGame struct {
+	Game       game.Game     `json:"game"`
+	MenaceSide game.Symbol   `json:"menace_side"`
+	Replay     menace.Replay `json:"replay"` // moves so far, so MENACE can learn from them
+}
+
+// saveGameFile saves a game to the file at path, replacing it if it exists.
+func saveGameFile(sg savedGame, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(f).Encode(sg); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// loadGameFile loads a game from the file at path.
+// Returns an error if the saved moves don't lead to the saved game.
+func loadGameFile(path string) (savedGame, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return savedGame{}, err
+	}
+	defer f.Close()
+	var sg savedGame
+	if err := json.NewDecoder(f).Decode(&sg); err != nil {
+		return savedGame{}, err
+	}
+	if !sg.MenaceSide.Player() {
+		return savedGame{}, fmt.Errorf("invalid side for MENACE: %v", sg.MenaceSide)
+	}
+	gm, err := sg.Replay.Game()
+	if err != nil {
+		return savedGame{}, fmt.Errorf("illegal move in saved game: %w", err)
+	}
+	if gm != sg.Game {
+		return savedGame{}, fmt.Errorf("saved moves lead to %v, not %v", gm, sg.Game)
+	}
+	return sg, nil
+}
+
+// human is an opponent that asks the user for each move.
+type human struct {
+	last   game.Board    // board after the user's last move
+	replay menace.Replay // moves so far, for saving the game
+}
+
+// Move shows MENACE's last move and the board, and reads a legal move from the user.
+// The user can also save the game to resume later, which quits the simulator.
+// If there is no more input, the game can't go on, so the simulator quits.
+func (h *human) Move(gm game.Game) game.Position {
+	if diff := gm.Board().Diff(h.last); len(diff) == 1 {
+		h.replay = append(h.replay, diff[0])
+	}
+	h.showMenaceMove(gm)
+	fmt.Println()
+	fmt.Println(gm.Pretty())
+	for {
+		fmt.Println(`Enter move (row col 0-2), or "save" to save the game and quit:`)
+		line, ok := readLine()
+		if !ok {
+			fmt.Println("Game abandoned")
+			os.Exit(0)
+		}
+		if strings.ToLower(line) == "save" {
+			h.save(gm)
+			continue
+		}
+		mv, err := game.ParsePosition(line)
+		if err != nil {
+			fmt.Println("Invalid move:", err)
+			continue
+		}
+		next, err := gm.Move(mv)
+		if err != nil {
+			fmt.Println("Invalid move:", err)
+			continue
+		}
+		h.last = next.Board()
+		h.replay = append(h.replay, mv)
+		return mv
+	}
+}
+
+// save asks for a file and saves the game in it, then quits the simulator.
+// If saving fails, the game goes on.
+func (h *human) save(gm game.Game) {
+	fmt.Println("Save game to which file?")
+	path, ok := readLine()
+	if !ok {
+		fmt.Println("Game abandoned")
+		os.Exit(0)
+	}
+	sg := savedGame{gm, gm.Turn().Other(), h.replay}
+	if err := saveGameFile(sg, path); err != nil {
+		fmt.Println("Save failed:", err)
+		return
+	}
+	fmt.Println("Game saved to", path)
+	os.Exit(0)
+}
+
+// showMenaceMove shows the move MENACE made since the user's last move, if any.
+func (h *human) showMenaceMove(gm game.Game) {
+	if diff := gm.Board().Diff(h.last); len(diff) == 1 {
+		fmt.Println("MENACE plays", diff[0])
+	}
+}
+
+// play plays a game between the user and MENACE, with MENACE playing turn,
+// continuing after the moves in start. If the game in start is already over,
+// only the result is shown.
+func play(m *menace.Menace, turn game.Symbol, start menace.Replay) {
+	gm, err := start.Game()
+	if err != nil {
+		log.Fatal("illegal move in game:", err)
+	}
+	h := human{last: gm.Board(), replay: slices.Clone(start)}
+	if !gm.Completed() {
+		var replay menace.Replay
+		_, replay, err = m.ResumeGame(&h, turn, true, start)
+		if err != nil {
+			log.Fatal("game failed: ", err)
+		}
+		if gm, err = replay.Game(); err != nil {
+			log.Fatal("illegal move in game:", err)
 		}
+		if !gm.Completed() {
+			fmt.Println("MENACE resigns!")
+			return
+		}
+		h.showMenaceMove(gm)
 	}
-	switch gm.Winner() {
-	case turn:
-		m.Reward(mvs, true)
-	case turn.Other():
-		m.Punish(mvs)
+	fmt.Println()
+	fmt.Println(gm.Pretty())
+	switch outcome := m.ClassifyOutcome(gm, turn, false); {
+	case outcome.MenaceWon:
+		fmt.Println("MENACE wins")
+	case outcome.Draw:
+		fmt.Println("Draw")
 	default:
-		m.Reward(mvs, false)
+		fmt.Println("MENACE loses")
 	}
 }
 
-func play(m *menace.Menace, turn game.Symbol) {
-	var (
-		gm  = game.New()
-		mvs = make(moves)
-	)
+// spectate shows a game of MENACE playing itself, without learning from it.
+// If greedy is true, MENACE plays its best move instead of drawing beads.
+func spectate(m menace.Menace, greedy bool) {
+	gm := game.New()
 	for !gm.Completed() {
 		fmt.Println()
 		fmt.Println(gm.Pretty())
-		if gm.Turn() == turn {
-			mv, next, moved, err := m.Move(gm)
-			if err != nil {
-				log.Fatal("illegal MENACE move:", err)
-			}
-			if !moved {
-				fmt.Println("MENACE resigns!")
-				m.Punish(mvs)
-				return
-			}
-			fmt.Println("MENACE plays", mv)
-			mvs[gm] = mv
-			gm = next
+		time.Sleep(500 * time.Millisecond)
+		var (
+			mv    game.Position
+			next  game.Game
+			moved bool
+			err   error
+		)
+		if greedy {
+			mv, next, moved, err = m.BestMove(gm)
 		} else {
-			var mv game.Position
-			for {
-				fmt.Println("Enter move (row col 0-2):")
-				var r, c int
-				fmt.Scanln(&r, &c)
-				mv = game.Position{Row: r, Col: c}
-				if err := mv.Valid(); err != nil {
-					fmt.Println("Invalid move:", err)
-					continue
-				}
-				next, err := gm.Move(mv)
-				if err != nil {
-					fmt.Println("Invalid move:", err)
-					continue
-				}
-				gm = next
-				break
-			}
+			mv, next, moved, err = m.Move(gm)
+		}
+		if err != nil {
+			log.Fatal("illegal MENACE move:", err)
 		}
+		if !moved {
+			fmt.Println("MENACE resigns as", gm.Turn())
+			return
+		}
+		fmt.Println("MENACE plays", mv)
+		gm = next
 	}
 	fmt.Println()
 	fmt.Println(gm.Pretty())
-	switch gm.Winner() {
-	case turn:
-		fmt.Println("MENACE wins")
-		m.Reward(mvs, true)
-	case turn.Other():
-		fmt.Println("MENACE loses")
-		m.Punish(mvs)
+}
+
+// openingBook shows MENACE's beads for each first move, with the chance of making it.
+func openingBook(m menace.Menace) {
+	var (
+		book  = m.OpeningBook()
+		moves = slices.SortedFunc(maps.Keys(book), func(a, b game.Position) int {
+			return cmp.Or(cmp.Compare(a.Row, b.Row), cmp.Compare(a.Col, b.Col))
+		})
+		total int
+	)
+	for _, n := range book {
+		total += n
+	}
+	fmt.Println("MENACE's opening moves:")
+	for _, mv := range moves {
+		var p float64
+		if total > 0 {
+			p = float64(book[mv]) / float64(total)
+		}
+		fmt.Printf("  %v: %d beads (%.1f%%)\n", mv, book[mv], p*100)
+	}
+}
+
+// analyze reads a board and shows MENACE's view of it alongside perfect play.
+func analyze(m menace.Menace) {
+	fmt.Println("Enter board (X, O, and . by row, e.g. X.O/.X./...):")
+	line, ok := readLine()
+	if !ok {
+		return
+	}
+	b, err := game.ParseBoard(line)
+	if err != nil {
+		fmt.Println("Invalid board:", err)
+		return
+	}
+	gm, err := game.FromBoard(b)
+	if err != nil {
+		fmt.Println("Invalid board:", err)
+		return
+	}
+	fmt.Println()
+	fmt.Println(gm.Pretty())
+	if gm.Completed() {
+		return
+	}
+	fmt.Println("Legal moves:", gm.Moves())
+	probs, err := m.MoveProbabilities(gm)
+	if err != nil {
+		fmt.Println("MENACE has no box for this position:", err)
+	} else {
+		fmt.Println("MENACE's move probabilities:")
+		for _, mv := range gm.Moves() {
+			if p, ok := probs[mv]; ok {
+				fmt.Printf("  %v: %.1f%%\n", mv, p*100)
+			}
+		}
+	}
+	switch v := gm.Value(); v {
+	case game.Cat:
+		fmt.Println("With perfect play: draw")
 	default:
-		fmt.Println("Draw")
-		m.Reward(mvs, false)
+		fmt.Println("With perfect play:", v, "wins")
 	}
+	fmt.Println("Best moves:", gm.BestMoves())
 }
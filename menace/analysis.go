@@ -0,0 +1,651 @@
+package menace
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/adambyle/menace/game"
+)
+
+// MoveQuality classifies a move by how it changes the outcome of perfect play
+// for the player who made it. See game.Game.Value.
+type MoveQuality byte
+
+const (
+	Best    MoveQuality = iota // keeps the best outcome available
+	Mistake                    // turns a forced win into a draw
+	Blunder                    // turns a forced win or draw into a loss
+)
+
+func (q MoveQuality) String() string {
+	switch q {
+	case Mistake:
+		return "Mistake"
+	case Blunder:
+		return "Blunder"
+	default:
+		return "Best"
+	}
+}
+
+// classify finds the quality of a legal move in a game state.
+func classify(gm game.Game, mv game.Position) MoveQuality {
+	next, err := gm.Move(mv)
+	if err != nil {
+		panic("classified move is illegal")
+	}
+	switch next.Value() {
+	case gm.Value():
+		return Best
+	case gm.Turn().Other():
+		return Blunder
+	default:
+		return Mistake
+	}
+}
+
+// MoveWithAnalysis retrieves MENACE's decision for a certain game state
+// like Move, and also classifies the move against perfect play.
+//
+// If moved returns false, MENACE resigns as in Move, and quality is meaningless.
+func (m Menace) MoveWithAnalysis(gm game.Game) (
+	mv game.Position, next game.Game, quality MoveQuality, moved bool, err error,
+) {
+	mv, next, moved, err = m.Move(gm)
+	if err != nil || !moved {
+		return
+	}
+	// The move is in the frame of gm, so it can be judged against gm directly.
+	quality = classify(gm, mv)
+	return
+}
+
+// BoxValue estimates how good a position is for the player whose turn it is,
+// based only on MENACE's beads. Finished games score 1 for a win, 0 for a draw,
+// and -1 for a loss, and other boxes average the values of the boxes that follow them,
+// weighted by beads. An empty box scores as a loss, since MENACE resigns.
+//
+// This is MENACE's learned evaluation, which may differ from the value
+// under perfect play (see game.Game.Value).
+func (m Menace) BoxValue(b game.Board) (float64, error) {
+	box := m.Box(b)
+	if box == nil {
+		return 0, fmt.Errorf("no box found for %v", b)
+	}
+	v := m.xValue(box, make(map[*Box]float64))
+	if box.game.Turn() == game.O {
+		v = -v
+	}
+	return v, nil
+}
+
+// xValue computes the value of a box from X's perspective for BoxValue.
+// Values are memoized in memo, since many paths lead to the same box.
+func (m Menace) xValue(box *Box, memo map[*Box]float64) float64 {
+	if v, ok := memo[box]; ok {
+		return v
+	}
+	var v float64
+	switch {
+	case box.game.Completed():
+		switch m.Winner(box.game) {
+		case game.X:
+			v = 1
+		case game.O:
+			v = -1
+		}
+	case box.totalBeads == 0:
+		// The player to move resigns.
+		v = 1
+		if box.game.Turn() == game.X {
+			v = -1
+		}
+	default:
+		for mv, beads := range box.beads {
+			v += float64(beads) * m.xValue(m.nextBox(box, mv, true), memo)
+		}
+		v /= float64(box.totalBeads)
+	}
+	memo[box] = v
+	return v
+}
+
+// MoveProbabilities returns the chance of MENACE making each move in a game state,
+// based on the beads in its box. Moves are in the frame of gm. Moves that are
+// transformations of another move in the box (such as the four corners of an
+// empty board) are only included once.
+func (m Menace) MoveProbabilities(gm game.Game) (map[game.Position]float64, error) {
+	beads, total, err := m.framedBeads(gm)
+	if err != nil {
+		return nil, err
+	}
+	probs := make(map[game.Position]float64)
+	for mv, n := range beads {
+		var p float64
+		if total > 0 {
+			p = float64(n) / float64(total)
+		}
+		probs[mv] = p
+	}
+	return probs, nil
+}
+
+// OpeningBook returns the beads for each first move MENACE can make from
+// an empty board. Moves that are transformations of another move (such as
+// the four corners) are only included once.
+func (m Menace) OpeningBook() map[game.Position]int {
+	return m.Box(game.Board{}).Beads()
+}
+
+// OpeningDiversity measures how varied MENACE's first move is, as the effective
+// number of openings it chooses between: 2 to the power of the entropy of the box
+// for an empty board (see Box.Entropy). It is 1 when MENACE always opens the same way,
+// and the number of moves in the box when every move is equally likely. Like
+// OpeningBook, moves that are transformations of another move count once, so
+// there are at most 3 openings: a corner, an edge, or the center.
+func (m Menace) OpeningDiversity() float64 {
+	return math.Exp2(m.Box(game.Board{}).Entropy())
+}
+
+// BeadsFor returns the beads in the box for a game state, with moves transformed
+// into the frame of gm, unlike Box.Beads, which uses the frame of the box's own
+// game state. Moves that are transformations of another move in the box (such as
+// the four corners of an empty board) are only included once.
+//
+// Returns an error if MENACE has no box for gm.
+func (m Menace) BeadsFor(gm game.Game) (map[game.Position]int, error) {
+	beads, _, err := m.framedBeads(gm)
+	return beads, err
+}
+
+// framedBeads returns the beads in the box for a game state, with moves
+// transformed into the frame of gm, and the total beads in the box.
+func (m Menace) framedBeads(gm game.Game) (map[game.Position]int, int, error) {
+	var (
+		b   = gm.Board()
+		box = m.Box(b)
+	)
+	if box == nil {
+		return nil, 0, fmt.Errorf("no box found for %v", gm)
+	}
+	rots, tp, ok := b.Transformation(box.game.Board())
+	if !ok {
+		panic("Menace.Box() returned unmatching game state")
+	}
+	beads := make(map[game.Position]int)
+	for mv, n := range box.beads {
+		beads[mv.Transform(rots, tp)] = n
+	}
+	return beads, box.totalBeads, nil
+}
+
+// PrettyBox returns a multi-line representation of a game state as MENACE's box
+// for it, where each empty space shows the number of beads for moving there.
+// Empty spaces without beads of their own, because they are a transformation of
+// another move in the box, show a dot.
+func (m Menace) PrettyBox(gm game.Game) (string, error) {
+	beads, _, err := m.framedBeads(gm)
+	if err != nil {
+		return "", err
+	}
+	var (
+		b     = gm.Board()
+		cells [game.BoardDim][game.BoardDim]string
+		width int
+	)
+	for r := range game.BoardDim {
+		for c := range game.BoardDim {
+			cell := b[r][c].String()
+			if n, ok := beads[game.Position{Row: r, Col: c}]; ok {
+				cell = strconv.Itoa(n)
+			}
+			cells[r][c] = cell
+			width = max(width, len(cell))
+		}
+	}
+	var sb strings.Builder
+	for r := range game.BoardDim {
+		for c := range game.BoardDim {
+			if c > 0 {
+				sb.WriteByte(' ')
+			}
+			fmt.Fprintf(&sb, "%*s", width, cells[r][c])
+		}
+		sb.WriteByte('\n')
+	}
+	return sb.String(), nil
+}
+
+// CanEverLose checks whether MENACE can lose a game, playing either side,
+// when it always plays its best move (see Menace.BestMove) and its opponent
+// plays any of the best moves under perfect play (see game.Game.BestMoves).
+// Resigning counts as losing.
+//
+// Once this returns false, MENACE has learned to never lose against perfect play.
+func (m Menace) CanEverLose() bool {
+	for _, side := range [...]game.Symbol{game.X, game.O} {
+		if m.canLose(game.New(), side, make(map[game.Game]bool)) {
+			return true
+		}
+	}
+	return false
+}
+
+// canLose checks whether MENACE, playing side, can lose from a game state
+// for CanEverLose. States already explored are in seen.
+func (m Menace) canLose(gm game.Game, side game.Symbol, seen map[game.Game]bool) bool {
+	if seen[gm] {
+		// Any loss from here would already have been found.
+		return false
+	}
+	seen[gm] = true
+	if gm.Completed() {
+		return m.Winner(gm) == side.Other()
+	}
+	if gm.Turn() == side {
+		_, next, moved, err := m.BestMove(gm)
+		if err != nil || !moved {
+			return true
+		}
+		return m.canLose(next, side, seen)
+	}
+	for _, mv := range gm.BestMoves() {
+		next, err := gm.Move(mv)
+		if err != nil {
+			panic("illegal move came from Game.BestMoves()")
+		}
+		if m.canLose(next, side, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+// LosingLines lists every game MENACE can lose playing menaceSide, when it plays
+// any move it has beads for, and its opponent plays any of the best moves under
+// perfect play (see game.Game.BestMoves). Games that end with MENACE resigning
+// are included. Where several of MENACE's moves are transformations of each
+// other, only one is followed. Returns empty if MENACE can't lose.
+//
+// These are concrete games to study, or to train MENACE with.
+func (m Menace) LosingLines(menaceSide game.Symbol) []Replay {
+	var (
+		lines  []Replay
+		replay Replay
+		walk   func(gm game.Game)
+	)
+	follow := func(gm game.Game, mv game.Position) {
+		next, err := gm.Move(mv)
+		if err != nil {
+			panic("illegal move came from MENACE's beads")
+		}
+		replay = append(replay, mv)
+		walk(next)
+		replay = replay[:len(replay)-1]
+	}
+	walk = func(gm game.Game) {
+		if gm.Completed() {
+			if m.Winner(gm) == menaceSide.Other() {
+				lines = append(lines, slices.Clone(replay))
+			}
+			return
+		}
+		if gm.Turn() != menaceSide {
+			for _, mv := range gm.BestMoves() {
+				follow(gm, mv)
+			}
+			return
+		}
+		beads, total, err := m.framedBeads(gm)
+		if err != nil || total == 0 || m.resigns(gm) {
+			lines = append(lines, slices.Clone(replay))
+			return
+		}
+		for _, mv := range gm.Moves() {
+			if beads[mv] > 0 {
+				follow(gm, mv)
+			}
+		}
+	}
+	walk(game.New())
+	return lines
+}
+
+// PolicyReachable collects every board that can come up in a game where MENACE
+// plays menaceSide, making any move it has beads for, and its opponent makes
+// any legal move. Unlike game.CanonicalBoards, moves MENACE has no beads for
+// cut off the games that follow them, and boards are not reduced by transformation.
+// Completed games are included, and games stop where MENACE would resign.
+func (m Menace) PolicyReachable(menaceSide game.Symbol) []game.Board {
+	var (
+		start  = game.New()
+		seen   = map[game.Game]bool{start: true}
+		queue  = []game.Game{start}
+		boards []game.Board
+	)
+	for len(queue) > 0 {
+		gm := queue[0]
+		queue = queue[1:]
+		boards = append(boards, gm.Board())
+		moves := gm.Moves()
+		if gm.Turn() == menaceSide && len(moves) > 0 {
+			var (
+				b   = gm.Board()
+				box = m.Box(b)
+			)
+			if box == nil || box.totalBeads == 0 || m.resigns(gm) {
+				continue
+			}
+			moves = slices.DeleteFunc(moves, func(mv game.Position) bool {
+				bmv, ok := boxMove(box, b, mv)
+				return !ok || box.beads[bmv] == 0
+			})
+		}
+		for _, mv := range moves {
+			next, err := gm.Move(mv)
+			if err != nil {
+				panic("illegal move came from Game.Moves()")
+			}
+			if !seen[next] {
+				seen[next] = true
+				queue = append(queue, next)
+			}
+		}
+	}
+	return boards
+}
+
+// PolicyDistance measures how differently two instances of MENACE play,
+// as the total variation distance between the move probabilities of matching
+// boxes, averaged over all boxes for unfinished games. It ranges from 0,
+// when both play identically, to 1, when they never make the same move.
+// An empty box is treated as fully different from a box with beads.
+//
+// Returns an error if the instances do not have the same boxes and moves.
+func (m Menace) PolicyDistance(other Menace) (float64, error) {
+	if len(m.boxes) != len(other.boxes) {
+		return 0, fmt.Errorf("boxes differ: %d and %d", len(m.boxes), len(other.boxes))
+	}
+	var (
+		total float64
+		count int
+	)
+	for _, box := range m.sortedBoxes() {
+		if box.game.Completed() {
+			continue
+		}
+		bb := box.game.Board()
+		obox := other.Box(bb)
+		if obox == nil {
+			return 0, fmt.Errorf("other has no box for %v", box.game)
+		}
+		if len(obox.beads) != len(box.beads) {
+			return 0, fmt.Errorf("boxes for %v have %d and %d moves",
+				box.game, len(box.beads), len(obox.beads))
+		}
+		rots, t, ok := obox.game.Board().Transformation(bb)
+		if !ok {
+			panic("Menace.Box() returned unmatching game state")
+		}
+		count++
+		switch {
+		case box.totalBeads == 0 && obox.totalBeads == 0:
+			continue
+		case box.totalBeads == 0 || obox.totalBeads == 0:
+			total++
+			continue
+		}
+		var d float64
+		for mv, beads := range box.beads {
+			obeads, ok := obox.beads[mv.Transform(rots, t)]
+			if !ok {
+				return 0, fmt.Errorf("other box for %v has no move %v", box.game, mv)
+			}
+			p := float64(beads) / float64(box.totalBeads)
+			q := float64(obeads) / float64(obox.totalBeads)
+			d += math.Abs(p - q)
+		}
+		total += d / 2
+	}
+	if count == 0 {
+		return 0, nil
+	}
+	return total / float64(count), nil
+}
+
+// RiskiestBox finds the box where MENACE most confidently plays a bad move:
+// the box whose most likely move (see Menace.BestMove) loses the most against
+// perfect play compared to the best move available, weighted by the chance
+// of MENACE making that move. Outcomes under perfect play score 1 for a win,
+// 0 for a draw, and -1 for a loss, so the returned risk ranges from 0 to 2.
+//
+// Perfect play is judged under standard rules (see game.Game.Value).
+// Returns nil if MENACE's most likely move is a best move in every box.
+func (m Menace) RiskiestBox() (*Box, float64) {
+	var (
+		riskiest *Box
+		risk     float64
+	)
+	for _, box := range m.sortedBoxes() {
+		if box.game.Completed() || box.totalBeads == 0 {
+			continue
+		}
+		var (
+			mv   = mostBeads(box)
+			side = box.game.Turn()
+			lost = valueFor(box.game.Value(), side) - valueFor(m.nextBox(box, mv, true).game.Value(), side)
+			r    = lost * float64(box.beads[mv]) / float64(box.totalBeads)
+		)
+		if r > risk {
+			riskiest, risk = box, r
+		}
+	}
+	return riskiest, risk
+}
+
+// OptimalityRate measures how closely MENACE plays to perfect play, as the
+// fraction of beads on best moves (see MoveQuality), averaged over all boxes
+// for unfinished games. It approaches 1 as MENACE learns to play perfectly.
+// An empty box scores 0, since resigning is never a best move.
+//
+// Perfect play is judged under standard rules (see game.Game.Value).
+func (m Menace) OptimalityRate() float64 {
+	var (
+		total float64
+		count int
+	)
+	for _, box := range m.sortedBoxes() {
+		if box.game.Completed() {
+			continue
+		}
+		count++
+		if box.totalBeads == 0 {
+			continue
+		}
+		best := 0
+		for mv, beads := range box.beads {
+			if classify(box.game, mv) == Best {
+				best += beads
+			}
+		}
+		total += float64(best) / float64(box.totalBeads)
+	}
+	if count == 0 {
+		return 0
+	}
+	return total / float64(count)
+}
+
+// ValuationErrors compares MENACE's own estimate of each position (see Menace.BoxValue)
+// with its value under perfect play, scored as in BoxValue, for every box of an
+// unfinished game. The errors are keyed by each box's canonical board (see
+// game.Game.BoxKey). A positive error means MENACE thinks the position is better
+// for the player to move than it is, and a negative error means worse. Errors
+// range from -2 to 2, and shrink towards 0 as MENACE learns.
+//
+// Perfect play is judged under standard rules (see game.Game.Value).
+func (m Menace) ValuationErrors() map[game.Board]float64 {
+	var (
+		errs = make(map[game.Board]float64)
+		memo = make(map[*Box]float64)
+	)
+	for _, box := range m.sortedBoxes() {
+		if box.game.Completed() {
+			continue
+		}
+		v := m.xValue(box, memo)
+		if box.game.Turn() == game.O {
+			v = -v
+		}
+		errs[box.game.BoxKey()] = v - valueFor(box.game.Value(), box.game.Turn())
+	}
+	return errs
+}
+
+// valueFor scores an outcome for a player as 1 for a win, 0 for a draw, and -1 for a loss.
+func valueFor(outcome, side game.Symbol) float64 {
+	switch outcome {
+	case side:
+		return 1
+	case side.Other():
+		return -1
+	default:
+		return 0
+	}
+}
+
+// AgreementRate measures how much a player plays like MENACE, as the fraction
+// of side's moves in the replays that match the move with the most beads in
+// MENACE's box (see Menace.BestMove), up to transformation, such as playing
+// a different corner of an empty board. Moves from boxes that are missing or
+// empty are skipped, as are replays from their first illegal move on.
+// Returns 0 if no moves are compared.
+func (m Menace) AgreementRate(replays []Replay, side game.Symbol) float64 {
+	var agreed, total int
+	for _, r := range replays {
+		r.Walk(func(_ int, gm game.Game, mv game.Position) bool {
+			if gm.Turn() != side {
+				return true
+			}
+			var (
+				b   = gm.Board()
+				box = m.Box(b)
+			)
+			if box == nil || box.totalBeads == 0 {
+				return true
+			}
+			total++
+			if bmv, ok := boxMove(box, b, mv); ok && bmv == mostBeads(box) {
+				agreed++
+			}
+			return true
+		})
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(agreed) / float64(total)
+}
+
+// BoxTrace describes one of MENACE's moves in a game, for TraceGame.
+type BoxTrace struct {
+	Game  game.Game             // game state MENACE moved from
+	Move  game.Position         // move MENACE made
+	Beads map[game.Position]int // beads in the box, in the frame of Game
+}
+
+// TraceGame lists the boxes MENACE drew from in a game where it played menaceSide,
+// with the move it made from each. Moves by the other side are skipped.
+//
+// Beads are MENACE's current beads, not the beads at the time of the game,
+// which aren't kept. Like MoveProbabilities, moves that are transformations
+// of another move in the box are only included once.
+//
+// Returns an error if the replay has an illegal move, or if MENACE has no box
+// for one of its moves.
+func (m Menace) TraceGame(r Replay, menaceSide game.Symbol) ([]BoxTrace, error) {
+	if _, err := r.Game(); err != nil {
+		return nil, err
+	}
+	var (
+		trace []BoxTrace
+		err   error
+	)
+	r.Walk(func(_ int, gm game.Game, mv game.Position) bool {
+		if gm.Turn() != menaceSide {
+			return true
+		}
+		var beads map[game.Position]int
+		beads, _, err = m.framedBeads(gm)
+		if err != nil {
+			return false
+		}
+		trace = append(trace, BoxTrace{gm, mv, beads})
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return trace, nil
+}
+
+// DivergeFromOptimal finds where MENACE went off book in a game where it played
+// menaceSide: the indices in the replay of its moves that were not best moves
+// (see MoveQuality). Returns empty if MENACE played perfectly throughout.
+//
+// Perfect play is judged under standard rules (see game.Game.Value).
+// Returns an error if the replay has an illegal move.
+func (m Menace) DivergeFromOptimal(r Replay, menaceSide game.Symbol) ([]int, error) {
+	if _, err := r.Game(); err != nil {
+		return nil, err
+	}
+	var diverged []int
+	r.Walk(func(step int, gm game.Game, mv game.Position) bool {
+		if gm.Turn() == menaceSide && classify(gm, mv) != Best {
+			diverged = append(diverged, step)
+		}
+		return true
+	})
+	return diverged, nil
+}
+
+// PrincipalVariation shows how MENACE expects a game to go: starting from gm,
+// MENACE plays its best move (see Menace.BestMove) for the player to move, and
+// the opponent answers, until the game ends or MENACE resigns. The moves made
+// after gm are returned, so the line is a full Replay only if gm is a new game.
+// Against MinimaxOpponent, this is the game MENACE plays against perfect play.
+//
+// MENACE is left unchanged. Returns an error if MENACE has no box for one of
+// the positions, or if the opponent makes an illegal move, along with the moves
+// made before it.
+func (m Menace) PrincipalVariation(gm game.Game, opp Opponent) (Replay, error) {
+	var (
+		side = gm.Turn()
+		line Replay
+	)
+	for !gm.Completed() {
+		if gm.Turn() != side {
+			mv := opp.Move(gm)
+			next, err := gm.Move(mv)
+			if err != nil {
+				return line, fmt.Errorf("opponent %T made illegal move %v in %v: %w", opp, mv, gm, err)
+			}
+			line = append(line, mv)
+			gm = next
+			continue
+		}
+		mv, next, moved, err := m.BestMove(gm)
+		if err != nil {
+			return line, err
+		}
+		if !moved {
+			break
+		}
+		line = append(line, mv)
+		gm = next
+	}
+	return line, nil
+}
@@ -0,0 +1,39 @@
+package menace
+
+import "github.com/adambyle/menace/game"
+
+// RecordDecisions starts or stops recording the beads in each box MENACE draws
+// from when it moves, as they were at the time of the move, before any reward
+// or punishment. Unlike TraceGame, which only knows the current beads, this
+// shows exactly what MENACE chose from. See Menace.Decisions.
+//
+// Decisions are recorded for Move and for training games, but not for
+// Suggest, BestMove, or games played without learning.
+func (m *Menace) RecordDecisions(on bool) {
+	m.record.recordDecisions = on
+	if !on {
+		m.record.decisions = nil
+	}
+}
+
+// Decisions returns the decisions recorded since recording started or
+// Decisions was last called, in the order they were made, and clears them.
+// See Menace.RecordDecisions.
+func (m *Menace) Decisions() []BoxTrace {
+	decisions := m.record.decisions
+	m.record.decisions = nil
+	return decisions
+}
+
+// recordDecision records a move from a box, if decisions are being recorded.
+// The box's game state is transformed to gm by rots and tp.
+func (m Menace) recordDecision(gm game.Game, mv game.Position, box *Box, rots int, tp bool) {
+	if !m.record.recordDecisions {
+		return
+	}
+	beads := make(map[game.Position]int, len(box.beads))
+	for bmv, n := range box.beads {
+		beads[bmv.Transform(rots, tp)] = n
+	}
+	m.record.decisions = append(m.record.decisions, BoxTrace{gm, mv, beads})
+}
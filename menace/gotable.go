@@ -0,0 +1,88 @@
+package menace
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"maps"
+	"slices"
+
+	"github.com/adambyle/menace/game"
+)
+
+// GenerateGoTable writes Go source for package pkg with a fixed player that makes
+// MENACE's current best move (see Menace.BestMove) in every position it can move
+// from, without depending on this module or learning any further:
+//
+//	func Move(board string) (row, col int, ok bool)
+//
+// Boards are written as in the move log (see Menace.AttachMoveLog), such as
+// "X../.O./...". Every transformation of each board MENACE has a box for is listed,
+// so that the generated player doesn't need to transform boards. Move returns false
+// for boards where MENACE would resign, and for boards that can't come up in a game.
+func (m Menace) GenerateGoTable(w io.Writer, pkg string) error {
+	var (
+		src   bytes.Buffer
+		moves = make(map[string]game.Position)
+	)
+	for _, gm := range reachableGames() {
+		mv, _, moved, err := m.BestMove(gm)
+		if err != nil {
+			return err
+		}
+		if moved {
+			moves[slashBoard(gm.Board())] = mv
+		}
+	}
+	fmt.Fprintf(&src, "// Code generated by menace.GenerateGoTable; DO NOT EDIT.\n\n")
+	fmt.Fprintf(&src, "package %s\n\n", pkg)
+	fmt.Fprintf(&src, "// moves maps boards to MENACE's move, as row*%d + col.\n", game.BoardDim)
+	fmt.Fprintf(&src, "var moves = map[string]int{\n")
+	for _, b := range slices.Sorted(maps.Keys(moves)) {
+		mv := moves[b]
+		fmt.Fprintf(&src, "%q: %d,\n", b, mv.Row*game.BoardDim+mv.Col)
+	}
+	fmt.Fprintf(&src, "}\n\n")
+	fmt.Fprintf(&src, "// Move returns MENACE's move for a board, given by rows of X, O, and . separated\n")
+	fmt.Fprintf(&src, "// by slashes, such as \"X../.O./...\". Returns false if MENACE resigns, or if\n")
+	fmt.Fprintf(&src, "// the board can't come up in a game.\n")
+	fmt.Fprintf(&src, "func Move(board string) (row, col int, ok bool) {\n")
+	fmt.Fprintf(&src, "mv, ok := moves[board]\n")
+	fmt.Fprintf(&src, "return mv / %d, mv %% %d, ok\n", game.BoardDim, game.BoardDim)
+	fmt.Fprintf(&src, "}\n")
+	formatted, err := format.Source(src.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(formatted)
+	return err
+}
+
+// reachableGames collects every unfinished game state that can be reached
+// by legal play, in the order they are found.
+func reachableGames() []game.Game {
+	var (
+		start = game.New()
+		seen  = map[game.Game]bool{start: true}
+		games []game.Game
+	)
+	for queue := []game.Game{start}; len(queue) > 0; queue = queue[1:] {
+		gm := queue[0]
+		if gm.Completed() {
+			continue
+		}
+		games = append(games, gm)
+		for _, mv := range gm.Moves() {
+			next, err := gm.Move(mv)
+			if err != nil {
+				panic("illegal move came from Game.Moves()")
+			}
+			if !seen[next] {
+				seen[next] = true
+				queue = append(queue, next)
+			}
+		}
+	}
+	return games
+}
@@ -3,9 +3,14 @@
 package menace
 
 import (
+	"cmp"
+	"errors"
 	"fmt"
 	"maps"
+	"math"
 	"math/rand"
+	"slices"
+	"strings"
 
 	"github.com/adambyle/menace/game"
 )
@@ -15,11 +20,13 @@ import (
 //
 // The zero-value is an invalid state. Please use New().
 type Menace struct {
-	// Mapping of game boards to the boxes used to decide which move to make.
-	// Some valid boards are not keys to this map, but there is a transformation for
-	// every such board that IS in the map.
+	// Mapping of canonical boards (see game.Game.BoxKey) to the boxes
+	// used to decide which move to make. A box's own game state may be
+	// any transformation of its key.
 	boxes   map[game.Board]*Box
 	options *Options
+	record  *record
+	rng     *rand.Rand // source of random choices, or nil for the shared source
 }
 
 // Default returns a MENACE instance with the default options. See DefaultOptions().
@@ -32,25 +39,34 @@ func Default() Menace {
 }
 
 // New creates a distinct instance of MENACE that can learn to play for both X and O.
+//
+// All invalid options are reported together in the returned error,
+// rather than only the first one found.
 func New(options Options) (Menace, error) {
+	if err := options.validate(); err != nil {
+		return Menace{}, err
+	}
+	if options.Lazy {
+		menace := Menace{
+			make(map[game.Board]*Box),
+			&options,
+			newRecord(options.RecentGames),
+			newRand(options.Seed),
+		}
+		menace.addBox(game.New())
+		return menace, nil
+	}
 	// Box for the first board, which won't be discovered by traversal.
-	firstBox := newBox(game.New())
+	firstBox := newBox(game.New(), &options)
 	menace := Menace{
 		map[game.Board]*Box{
 			{}: &firstBox,
 		},
 		&options,
-	}
-	for i, b := range menace.options.Beads {
-		if b < 1 {
-			return Menace{}, fmt.Errorf("beads for layer %d < 0", i)
-		}
-	}
-	if options.WinReward < 0 {
-		return Menace{}, fmt.Errorf("reward is negative")
+		newRecord(options.RecentGames),
+		newRand(options.Seed),
 	}
 	// Create boxes for all unique board states.
-	const layerCount = 9
 	var (
 		nextNodes = []game.Game{game.New()} // nodes to process on the next step
 		nodes     []game.Game               // nodes to process this layer
@@ -70,42 +86,38 @@ func New(options Options) (Menace, error) {
 				continue
 			}
 			var (
-				moves = n.Moves()               // the valid moves on this node
-				box   = menace.boxes[n.Board()] // the working node's box
-				nexts = make(map[*Box]bool)     // the found/created branching games
+				moves = n.Moves()                // the valid moves on this node
+				box   = menace.boxes[n.BoxKey()] // the working node's box
+				nexts = make(map[*Box]bool)      // the found/created branching games
 			)
 			// Collect nodes for the next layer by finding unique next game states
 			// from the current one.
-		moves:
 			for _, mv := range moves {
 				next, err := n.Move(mv)
 				if err != nil {
 					panic("illegal move came from Game.Moves()")
 				}
-				nb := next.Board()
+				key := next.BoxKey()
 				// If a box already exists for a similar board, link to that one and move on.
-				for _, existing := range nextNodes {
-					eb := existing.Board()
-					if _, _, ok := nb.Transformation(eb); ok {
-						ebx := menace.boxes[eb]
-						// This board might STILL be a unique branch from the working node.
-						// Update nexts/beads if true.
-						if !nexts[ebx] {
-							box.beads[mv] = layerBeads
-							box.totalBeads += layerBeads
-							box.nexts[mv] = ebx
-							nexts[ebx] = true
-						}
-						continue moves
+				// Boxes are keyed by canonical board, so this is a single lookup.
+				if ebx, ok := menace.boxes[key]; ok {
+					// This board might STILL be a unique branch from the working node.
+					// Update nexts/beads if true.
+					if !nexts[ebx] {
+						box.beads[mv] = layerBeads
+						box.totalBeads += layerBeads
+						box.nexts[mv] = ebx
+						nexts[ebx] = true
 					}
+					continue
 				}
 				nextNodes = append(nextNodes, next)
 				// Register this unique move with the box corresponding
 				// to the node we're branching off of.
 				box.beads[mv] = layerBeads
 				box.totalBeads += layerBeads
-				nextBox := newBox(next)
-				menace.boxes[nb] = &nextBox
+				nextBox := newBox(next, menace.options)
+				menace.boxes[key] = &nextBox
 				box.nexts[mv] = &nextBox
 				nexts[&nextBox] = true
 				if l+1 < layerCount {
@@ -117,11 +129,195 @@ func New(options Options) (Menace, error) {
 	return menace, nil
 }
 
-// Move retrieves MENACE's decision for a certain game state.
+// Clone creates an independent copy of MENACE, with its own boxes, options, and stats.
+// The replay buffer, move log, and recorded decisions, if any, are not copied.
+// If Options.Seed is set, the copy's random choices start over from the seed.
+func (m Menace) Clone() Menace {
+	var (
+		options = *m.options
+		rec     = *m.record
+	)
+	rec.recent = slices.Clone(rec.recent)
+	rec.samples = slices.Clone(rec.samples)
+	rec.resignations = slices.Clone(rec.resignations)
+	rec.replays = nil
+	rec.moveLog = nil
+	rec.decisions, rec.recordDecisions = nil, false
+	clone := Menace{make(map[game.Board]*Box, len(m.boxes)), &options, &rec, newRand(options.Seed)}
+	copies := make(map[*Box]*Box, len(m.boxes))
+	for key, box := range m.boxes {
+		c := *box
+		c.beads = maps.Clone(box.beads)
+		c.options = &options
+		copies[box] = &c
+		clone.boxes[key] = &c
+	}
+	for _, c := range copies {
+		nexts := make(map[game.Position]*Box, len(c.nexts))
+		for mv, next := range c.nexts {
+			nexts[mv] = copies[next]
+		}
+		c.nexts = nexts
+	}
+	return clone
+}
+
+// Options returns a copy of the options MENACE was created with.
+func (m Menace) Options() Options {
+	return *m.options
+}
+
+// NewFromPrior creates an instance of MENACE like New, but with the beads
+// in each box copied from the matching box in a prior instance, multiplied by
+// scale. Every move keeps at least 1 bead, and no more than Options.MaxBeads.
 //
-// If moved returns false, the specified box exists but is empty.
+// Returns an error if prior does not have the same boxes and moves as the new instance.
+func NewFromPrior(options Options, prior Menace, scale float64) (Menace, error) {
+	menace, err := New(options)
+	if err != nil {
+		return Menace{}, err
+	}
+	if options.Lazy {
+		// Only the boxes the prior has are needed.
+		for _, pbox := range prior.sortedBoxes() {
+			menace.Box(pbox.game.Board())
+		}
+	}
+	for _, box := range menace.sortedBoxes() {
+		var (
+			bb   = box.game.Board()
+			pbox = prior.Box(bb)
+		)
+		if pbox == nil {
+			return Menace{}, fmt.Errorf("prior has no box for %v", box.game)
+		}
+		if len(pbox.beads) != len(box.beads) {
+			return Menace{}, fmt.Errorf("prior box for %v has %d moves, not %d",
+				box.game, len(pbox.beads), len(box.beads))
+		}
+		rots, t, ok := pbox.game.Board().Transformation(bb)
+		if !ok {
+			panic("Menace.Box() returned unmatching game state")
+		}
+		box.totalBeads = 0
+		for mv := range box.beads {
+			pbeads, ok := pbox.beads[mv.Transform(rots, t)]
+			if !ok {
+				return Menace{}, fmt.Errorf("prior box for %v has no move %v", box.game, mv)
+			}
+			beads := max(1, int(math.Floor(float64(pbeads)*scale)))
+			if options.MaxBeads > 0 {
+				beads = min(beads, options.MaxBeads)
+			}
+			box.beads[mv] = beads
+			box.totalBeads += beads
+		}
+	}
+	return menace, nil
+}
+
+// Move retrieves MENACE's decision for a certain game state, by drawing a bead
+// from its box at random, or as in BestMove for boxes past Options.GreedyAfter.
+//
+// If moved returns false, MENACE resigns, because the specified box exists
+// but is empty, or because MENACE knows it is beaten (see Options.ResignValue).
+// See Menace.Resignations.
 func (m Menace) Move(gm game.Game) (
 	move game.Position, result game.Game, moved bool, err error,
+) {
+	return m.play(gm, true, m.drawBead)
+}
+
+// Suggest retrieves the move MENACE would make for a certain game state,
+// drawn at random the same way as in Move, without making the move.
+// Nothing is recorded, so the box is not marked visited and resignations
+// are not recorded. Since moves are drawn at random, repeated calls may
+// suggest different moves.
+//
+// If moved returns false, MENACE would resign, as in Move.
+func (m Menace) Suggest(gm game.Game) (move game.Position, moved bool, err error) {
+	move, _, moved, err = m.play(gm, false, m.drawBead)
+	return
+}
+
+// drawBead draws a random bead from a box with beads, and returns its move.
+// Beads are counted through moves in row-major order, so that the same random
+// number always draws the same move. Boxes with more beads than Options.GreedyAfter
+// give their move with the most beads instead.
+func (m Menace) drawBead(box *Box) game.Position {
+	if g := m.options.GreedyAfter; g > 0 && box.totalBeads > g {
+		return mostBeads(box)
+	}
+	beadIndex := m.intn(box.totalBeads)
+	for _, mv := range box.moves() {
+		beadIndex -= box.beads[mv]
+		if beadIndex < 0 {
+			return mv
+		}
+	}
+	panic("bead index exceeded total beads")
+}
+
+// newRand creates the source of MENACE's random choices for Options.Seed,
+// or nil to use the shared source in math/rand.
+func newRand(seed int64) *rand.Rand {
+	if seed == 0 {
+		return nil
+	}
+	return rand.New(rand.NewSource(seed))
+}
+
+// intn draws a random number in [0, n) from MENACE's source of random choices.
+func (m Menace) intn(n int) int {
+	if m.rng == nil {
+		return rand.Intn(n)
+	}
+	return m.rng.Intn(n)
+}
+
+// BestMove retrieves MENACE's most likely decision for a certain game state,
+// which is the move with the most beads, instead of drawing a bead at random.
+// Ties are broken by choosing the earliest position, in row-major order.
+//
+// If moved returns false, MENACE resigns, as in Move.
+// Unlike Move, the box is not marked visited and resignations are not recorded.
+func (m Menace) BestMove(gm game.Game) (
+	move game.Position, result game.Game, moved bool, err error,
+) {
+	return m.play(gm, false, mostBeads)
+}
+
+// resigns checks whether MENACE gives up on a game state it is losing
+// against perfect play, according to Options.ResignValue.
+func (m Menace) resigns(gm game.Game) bool {
+	if m.options.ResignValue == 0 || m.options.Rule != game.Standard {
+		return false
+	}
+	if gm.Value() != gm.Turn().Other() {
+		return false
+	}
+	v, err := m.BoxValue(gm.Board())
+	return err == nil && v < m.options.ResignValue
+}
+
+// mostBeads returns the move with the most beads in a box with beads,
+// choosing the earliest position in row-major order for ties.
+func mostBeads(box *Box) game.Position {
+	moves := box.moves()
+	best := moves[0]
+	for _, mv := range moves[1:] {
+		if box.beads[mv] > box.beads[best] {
+			best = mv
+		}
+	}
+	return best
+}
+
+// play makes a move chosen from the box for a game state. choose is only called
+// for boxes with beads, and returns a move in the box's frame. If record is true,
+// the box is marked visited, and resignations are recorded.
+func (m Menace) play(gm game.Game, record bool, choose func(box *Box) game.Position) (
+	move game.Position, result game.Game, moved bool, err error,
 ) {
 	var (
 		b   = gm.Board()
@@ -131,53 +327,201 @@ func (m Menace) Move(gm game.Game) (
 		err = fmt.Errorf("no box found for %v", gm)
 		return
 	}
+	// Box always returns a box for a transformation of b, unless MENACE's boxes
+	// are corrupt (see Menace.Validate).
 	rots, tp, ok := b.Transformation(box.game.Board())
 	if !ok {
-		panic("Menace.Box() returned unmatching game state")
-	}
-	if box.totalBeads == 0 {
-		// No move made; box is empty.
+		err = fmt.Errorf("box for %v is for unmatching game state %v", gm, box.game)
 		return
 	}
-	beadIndex := rand.Intn(box.totalBeads)
-	var mv game.Position
-	for m, beads := range box.beads {
-		beadIndex -= beads
-		if beadIndex < 0 {
-			mv = m
-			break
+	if box.totalBeads == 0 || m.resigns(gm) {
+		// No move made; box is empty, or MENACE knows it's beaten.
+		if record {
+			m.record.resignations = append(m.record.resignations, b)
 		}
+		return
+	}
+	if record {
+		box.visited = true
 	}
-	tmv := mv.Transform(rots, tp)
+	tmv := choose(box).Transform(rots, tp)
 	result, err = gm.Move(tmv)
 	if err != nil {
 		return
 	}
+	if record {
+		m.recordDecision(gm, tmv, box, rots, tp)
+	}
 	return tmv, result, true, nil
 }
 
-func (m Menace) adjust(moves map[game.Game]game.Position, amount int) {
-	for gm, mv := range moves {
+// adjust adds amount beads (or removes them, if negative) for each move in a mapping
+// of game states to moves, or spreads amount across the moves if Options.LengthNormalize
+// is set, and marks their boxes visited. Game states with no box are skipped,
+// and frozen boxes (see Menace.Freeze) are not adjusted. With Options.CreditFinalK,
+// only the latest moves are adjusted or marked visited.
+// Moves that don't match their box, which only happens if MENACE's boxes
+// are corrupt (see Menace.Validate), are skipped and reported in the returned error.
+func (m Menace) adjust(moves map[game.Game]game.Position, amount int) error {
+	var (
+		errs  []error
+		games = slices.SortedFunc(maps.Keys(moves), func(a, b game.Game) int {
+			return cmp.Compare(a.SpacesFilled(), b.SpacesFilled())
+		})
+	)
+	if k := m.options.CreditFinalK; k > 0 && k < len(games) {
+		games = games[len(games)-k:]
+	}
+	for i, gm := range games {
 		var (
+			mv  = moves[gm]
 			gb  = gm.Board()
 			box = m.Box(gb)
 		)
 		if box == nil {
 			continue
 		}
-		var (
-			bb          = box.game.Board()
-			rots, t, ok = bb.Transformation(gb)
-		)
+		tmv, ok := boxMove(box, gb, mv)
 		if !ok {
-			panic("Menace.Box() returned unmatching game state")
+			errs = append(errs, fmt.Errorf("box for %v has no move matching %v", gm, mv))
+			continue
+		}
+		if !box.frozen {
+			box.Tune(map[game.Position]int{
+				tmv: m.share(amount, i, len(games)),
+			})
 		}
-		tmv := mv.Transform(rots, t)
-		box.Tune(map[game.Position]int{
-			tmv: amount,
+		box.visited = true
+	}
+	return errors.Join(errs...)
+}
+
+// share returns the beads to add for move i of n moves in a game, in the order
+// they were made. Normally every move gets amount, but with Options.LengthNormalize,
+// amount is split evenly across the moves, with any remainder going one bead each
+// to the latest moves, which are closest to the outcome.
+func (m Menace) share(amount, i, n int) int {
+	if !m.options.LengthNormalize {
+		return amount
+	}
+	var (
+		s   = amount / n
+		rem = amount % n // same sign as amount
+	)
+	switch {
+	case rem > 0 && i >= n-rem:
+		s++
+	case rem < 0 && i >= n+rem:
+		s--
+	}
+	return s
+}
+
+// boxMove transforms a move on board b into the frame of its box, which must
+// be the box for b. When the box's board is symmetric, a move can have several
+// equivalent positions in the box's frame, and the one with beads is chosen.
+// Returns false if the move has no equivalent in the box.
+func boxMove(box *Box, b game.Board, mv game.Position) (game.Position, bool) {
+	bb := box.game.Board()
+	for rots := range game.Rotations {
+		for _, t := range [...]bool{false, true} {
+			if b.Transform(rots, t) != bb {
+				continue
+			}
+			tmv := mv.Transform(rots, t)
+			if _, ok := box.beads[tmv]; ok {
+				return tmv, true
+			}
+		}
+	}
+	return game.Position{}, false
+}
+
+// AdjustStrict adds amount beads (or removes them, if negative) for each move
+// MENACE made in a mapping of game states to moves, like Punish and Reward.
+//
+// Unlike Punish and Reward, which skip game states that have no box,
+// it returns an error listing every such game state and adjusts nothing.
+// It also returns an error for moves that don't match their box, after
+// adjusting the other moves. Options.LengthNormalize applies as in Punish and Reward.
+func (m Menace) AdjustStrict(moves map[game.Game]game.Position, amount int) error {
+	var missing []string
+	for gm := range moves {
+		if m.Box(gm.Board()) == nil {
+			missing = append(missing, gm.String())
+		}
+	}
+	if len(missing) > 0 {
+		slices.Sort(missing)
+		return fmt.Errorf("no box found for %d game states: %s",
+			len(missing), strings.Join(missing, "; "))
+	}
+	return m.adjust(moves, amount)
+}
+
+// DedupMoves collapses game states in a mapping of game states to moves that
+// are transformations of each other, since they share a box and would otherwise
+// have that box tuned more than once. One game state of each group is kept,
+// along with the move made in it.
+//
+// A single game never reaches two symmetric states, since every move adds a symbol,
+// so this only matters for mappings combined from several games.
+func DedupMoves(moves map[game.Game]game.Position) map[game.Game]game.Position {
+	var (
+		deduped = make(map[game.Game]game.Position)
+		games   = slices.SortedFunc(maps.Keys(moves), func(a, b game.Game) int {
+			return cmp.Compare(a.String(), b.String())
 		})
-		continue
+	)
+games:
+	for _, gm := range games {
+		for kept := range deduped {
+			if _, _, ok := gm.Board().Transformation(kept.Board()); ok && gm.Turn() == kept.Turn() {
+				continue games
+			}
+		}
+		deduped[gm] = moves[gm]
 	}
+	return deduped
+}
+
+// CanonicalizeMoves maps each game state in a mapping of game states to moves
+// to its canonical board (see game.Board.Canonical), with its move transformed
+// to match. Game states that are transformations of each other, such as those
+// from symmetric games, produce the same entry, so mappings from different
+// games can be compared and merged directly.
+//
+// When the canonical board is symmetric, several positions are equivalent moves
+// on it, and the earliest of them in row-major order is used.
+func CanonicalizeMoves(moves map[game.Game]game.Position) map[game.Board]game.Position {
+	canonical := make(map[game.Board]game.Position, len(moves))
+	for gm, mv := range moves {
+		canon, cmv := canonicalMove(gm.Board(), mv)
+		canonical[canon] = cmv
+	}
+	return canonical
+}
+
+// canonicalMove transforms a board to its canonical board, and a move on it
+// to the earliest equivalent move on the canonical board in row-major order.
+func canonicalMove(b game.Board, mv game.Position) (game.Board, game.Position) {
+	var (
+		canon = b.Canonical()
+		best  game.Position
+		found bool
+	)
+	for rots := range game.Rotations {
+		for _, t := range [...]bool{false, true} {
+			if b.Transform(rots, t) != canon {
+				continue
+			}
+			tmv := mv.Transform(rots, t)
+			if !found || tmv.Row < best.Row || tmv.Row == best.Row && tmv.Col < best.Col {
+				best, found = tmv, true
+			}
+		}
+	}
+	return canon, best
 }
 
 // Punish adjusts MENACE's strategy based on the choices it made for a losing game.
@@ -185,35 +529,417 @@ func (m Menace) adjust(moves map[game.Game]game.Position, amount int) {
 // It takes a mapping of game states to the move it made in that state.
 func (m Menace) Punish(moves map[game.Game]game.Position) {
 	m.adjust(moves, -1)
+	m.observe(moves, lost)
 }
 
-// Punish adjusts MENACE's strategy based on the choices it made for a winning or drawing game.
+// Reward adjusts MENACE's strategy based on the choices it made for a winning or drawing game.
 //
 // It takes a mapping of game states to the move it made in that state.
+// Draws are rewarded with Options.DrawRewardFunc when it is set, and with
+// Options.DrawReward otherwise. A negative draw reward takes beads away
+// from the drawing moves, as in Punish, though never below 0.
 func (m Menace) Reward(moves map[game.Game]game.Position, win bool) {
 	var reward int
-	if win {
+	switch {
+	case win:
 		reward = m.options.WinReward
-	} else {
+	case m.options.DrawRewardFunc != nil:
+		reward = m.options.DrawRewardFunc(moveCount(moves))
+	default:
 		reward = m.options.DrawReward
 	}
 	m.adjust(moves, reward)
+	if win {
+		m.observe(moves, won)
+	} else {
+		m.observe(moves, drew)
+	}
+}
+
+// moveCount finds the number of symbols on the board after the last move
+// in a mapping of game states to moves.
+func moveCount(moves map[game.Game]game.Position) int {
+	count := 0
+	for gm := range moves {
+		count = max(count, gm.SpacesFilled()+1)
+	}
+	return count
+}
+
+// Winner checks for the winner of a game under the rule MENACE is trained for.
+// See Options.Rule.
+func (m Menace) Winner(gm game.Game) game.Symbol {
+	return gm.WinnerWithRule(m.options.Rule)
+}
+
+// ApplyOutcome adjusts MENACE's strategy for both players in a finished game.
+//
+// The winner's moves are rewarded and the loser's moves are punished.
+// If the game is a draw (Cat), both players' moves are rewarded for drawing.
+// A winner of Empty (an unfinished game) has no effect.
+func (m *Menace) ApplyOutcome(xMoves, oMoves map[game.Game]game.Position, winner game.Symbol) {
+	switch winner {
+	case game.X:
+		m.Reward(xMoves, true)
+		m.Punish(oMoves)
+	case game.O:
+		m.Reward(oMoves, true)
+		m.Punish(xMoves)
+	case game.Cat:
+		m.Reward(xMoves, false)
+		m.Reward(oMoves, false)
+	}
 }
 
 // Box retrieves the box for the given game state, or a transformation
 // of the given board state.
+//
+// With Options.Lazy, the box is created on first access, if the board
+// can be reached by legal play.
 func (m Menace) Box(board game.Board) *Box {
-	for rots := range game.Rotations {
-		var tb game.Board
-		tb = board.Transform(rots, false)
-		if box, ok := m.boxes[tb]; ok {
-			return box
+	box, ok := m.boxes[board.Canonical()]
+	if ok || !m.options.Lazy {
+		return box
+	}
+	gm, err := game.FromBoard(board)
+	if err != nil {
+		return nil
+	}
+	return m.addBox(gm)
+}
+
+// addBox creates the box for a game state, seeded with the beads for its layer
+// on each distinct move, as New does for every box up front. Its links to the next
+// boxes are only made for boxes that already exist; see nextBox.
+func (m Menace) addBox(gm game.Game) *Box {
+	box := newBox(gm, m.options)
+	m.boxes[gm.BoxKey()] = &box
+	if gm.Completed() {
+		return &box
+	}
+	var (
+		layerBeads = m.options.Beads[gm.SpacesFilled()]
+		seen       = make(map[game.Board]bool)
+	)
+	for _, mv := range gm.Moves() {
+		next, err := gm.Move(mv)
+		if err != nil {
+			panic("illegal move came from Game.Moves()")
+		}
+		key := next.BoxKey()
+		if seen[key] {
+			continue
 		}
-		tb = board.Transform(rots, true)
-		if box, ok := m.boxes[tb]; ok {
-			return box
+		seen[key] = true
+		box.beads[mv] = layerBeads
+		box.totalBeads += layerBeads
+		if nbx, ok := m.boxes[key]; ok {
+			box.nexts[mv] = nbx
 		}
 	}
+	return &box
+}
+
+// nextBox returns the box that a move in a box leads to. With Options.Lazy,
+// the link is made on first use, and if create is true, the next box is created
+// if it doesn't exist yet. Otherwise, nextBox returns nil for missing boxes.
+func (m Menace) nextBox(box *Box, mv game.Position, create bool) *Box {
+	if next, ok := box.nexts[mv]; ok || !m.options.Lazy {
+		return next
+	}
+	after, err := box.game.Move(mv)
+	if err != nil {
+		panic("illegal move came from Game.Moves()")
+	}
+	next, ok := m.boxes[after.BoxKey()]
+	if !ok {
+		if !create {
+			return nil
+		}
+		next = m.addBox(after)
+	}
+	box.nexts[mv] = next
+	return next
+}
+
+// UndecidedBoxes collects the boxes whose bead distributions have an entropy
+// above threshold (see Box.Entropy), meaning MENACE is still unsure which move to make.
+func (m Menace) UndecidedBoxes(threshold float64) []*Box {
+	var undecided []*Box
+	for _, box := range m.sortedBoxes() {
+		if box.Entropy() > threshold {
+			undecided = append(undecided, box)
+		}
+	}
+	return undecided
+}
+
+// CollapsedBoxes collects the boxes where a single move holds more than fraction
+// of the beads, such as 0.99, meaning MENACE has all but memorized its move.
+// Whether that is good depends on whether the move is a best move (see MoveQuality).
+// Boxes with only one move, or no beads, are left out.
+func (m Menace) CollapsedBoxes(fraction float64) []*Box {
+	var collapsed []*Box
+	for _, box := range m.sortedBoxes() {
+		if len(box.beads) < 2 {
+			continue
+		}
+		_, beads, ok := box.Favored()
+		if ok && float64(beads) > fraction*float64(box.totalBeads) {
+			collapsed = append(collapsed, box)
+		}
+	}
+	return collapsed
+}
+
+// UnvisitedBoxes collects the boxes for unfinished games that MENACE has
+// never made a move from or adjusted. See Box.Visited.
+func (m Menace) UnvisitedBoxes() []*Box {
+	var unvisited []*Box
+	for _, box := range m.sortedBoxes() {
+		if !box.visited && !box.game.Completed() {
+			unvisited = append(unvisited, box)
+		}
+	}
+	return unvisited
+}
+
+// Coverage returns the fraction of boxes for unfinished games that MENACE has
+// visited (see Box.Visited), from 0 for a fresh instance to 1 once every box
+// has been used. Like visits, coverage is cleared by Menace.ResetStats.
+func (m *Menace) Coverage() float64 {
+	var visited, total int
+	for _, box := range m.boxes {
+		if box.game.Completed() {
+			continue
+		}
+		total++
+		if box.visited {
+			visited++
+		}
+	}
+	return float64(visited) / float64(total)
+}
+
+// MemStats counts what takes up most of MENACE's memory: its boxes, the
+// entries for moves in their beads, and the entries for moves in their links
+// to the next boxes. These grow quickly with the size of the board.
+func (m Menace) MemStats() (boxes, beadEntries, nextEntries int) {
+	for _, box := range m.boxes {
+		beadEntries += len(box.beads)
+		nextEntries += len(box.nexts)
+	}
+	return len(m.boxes), beadEntries, nextEntries
+}
+
+// LayerAverageBeads returns the average total beads of the boxes for unfinished
+// games in each layer, where layer i holds the boxes with i symbols on the board.
+// Layers without such boxes average 0.
+func (m Menace) LayerAverageBeads() [layerCount]float64 {
+	var (
+		totals [layerCount]float64
+		counts [layerCount]int
+	)
+	for _, box := range m.boxes {
+		if box.game.Completed() {
+			continue
+		}
+		l := box.game.SpacesFilled()
+		totals[l] += float64(box.totalBeads)
+		counts[l]++
+	}
+	for l, count := range counts {
+		if count > 0 {
+			totals[l] /= float64(count)
+		}
+	}
+	return totals
+}
+
+// sortedBoxes lists all boxes in a stable order, by layer and then by board.
+func (m Menace) sortedBoxes() []*Box {
+	boxes := slices.Collect(maps.Values(m.boxes))
+	slices.SortFunc(boxes, func(a, b *Box) int {
+		return cmp.Or(
+			cmp.Compare(a.game.SpacesFilled(), b.game.SpacesFilled()),
+			cmp.Compare(a.game.Board().String(), b.game.Board().String()),
+		)
+	})
+	return boxes
+}
+
+// Validate checks that MENACE's boxes are consistent: each box is stored under
+// its canonical board (see game.Game.BoxKey), no two boxes are for transformations of the same board, each box's
+// bead total matches its beads, and every move in a box leads to a box in MENACE
+// for the game state after that move.
+//
+// Every problem found is reported in the returned error, naming the boards involved.
+// A valid instance of MENACE, however it was created, returns nil.
+func (m Menace) Validate() error {
+	var (
+		errs      []error
+		canonical = make(map[game.Board]*Box, len(m.boxes))
+	)
+	for key, box := range m.boxes {
+		if key != box.game.BoxKey() {
+			errs = append(errs, fmt.Errorf("box for %v is stored under %v, not its canonical board",
+				box.game, key))
+		}
+	}
+	for _, box := range m.sortedBoxes() {
+		bb := box.game.Board()
+		if other, ok := canonical[bb.Canonical()]; ok {
+			errs = append(errs, fmt.Errorf("boxes for %v and %v are transformations of each other",
+				other.game, box.game))
+		} else {
+			canonical[bb.Canonical()] = box
+		}
+		total := 0
+		for _, beads := range box.beads {
+			total += beads
+		}
+		if total != box.totalBeads {
+			errs = append(errs, fmt.Errorf("box for %v has %d beads but a total of %d",
+				box.game, total, box.totalBeads))
+		}
+		for _, mv := range box.moves() {
+			next, ok := box.nexts[mv]
+			if !ok {
+				// Lazily built boxes are only linked once the move is followed.
+				if !m.options.Lazy {
+					errs = append(errs, fmt.Errorf("box for %v has no next box for move %v", box.game, mv))
+				}
+				continue
+			}
+			if m.boxes[next.game.BoxKey()] != next {
+				errs = append(errs, fmt.Errorf("box for %v leads to %v by move %v, which is not in MENACE",
+					box.game, next.game, mv))
+				continue
+			}
+			after, err := box.game.Move(mv)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("box for %v has illegal move %v: %w", box.game, mv, err))
+				continue
+			}
+			_, _, ok = after.Board().Transformation(next.game.Board())
+			if !ok || after.Turn() != next.game.Turn() {
+				errs = append(errs, fmt.Errorf("box for %v leads to %v by move %v, not %v",
+					box.game, next.game, mv, after))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Prune removes the boxes that can't be reached from the box for an empty board
+// by following the moves in each box, and returns how many were removed.
+// A new instance of MENACE has no such boxes.
+//
+// With Options.Lazy, games are followed through boxes that haven't been created
+// yet as if they had every distinct move.
+func (m *Menace) Prune() int {
+	var (
+		reached = make(map[*Box]bool)
+		seen    = map[game.Board]bool{{}: true}
+		queue   = []game.Game{game.New()}
+	)
+	for len(queue) > 0 {
+		gm := queue[0]
+		queue = queue[1:]
+		moves := gm.Moves()
+		if box, ok := m.boxes[gm.BoxKey()]; ok {
+			reached[box] = true
+			gm, moves = box.game, box.moves()
+		}
+		for _, mv := range moves {
+			next, err := gm.Move(mv)
+			if err != nil {
+				panic("illegal move came from Game.Moves()")
+			}
+			if key := next.BoxKey(); !seen[key] {
+				seen[key] = true
+				queue = append(queue, next)
+			}
+		}
+	}
+	pruned := 0
+	for key, box := range m.boxes {
+		if !reached[box] {
+			delete(m.boxes, key)
+			pruned++
+		}
+	}
+	return pruned
+}
+
+// ReseedUnvisited sets every move in the boxes MENACE has never visited (see
+// Menace.UnvisitedBoxes) to the given number of beads, no more than Options.MaxBeads,
+// so that they are explored more readily in further training. Visited boxes and
+// frozen boxes (see Menace.Freeze) are left alone, and the boxes stay unvisited.
+//
+// Panics if beads is negative.
+func (m *Menace) ReseedUnvisited(beads int) {
+	if beads < 0 {
+		panic("bead count is negative")
+	}
+	if m.options.MaxBeads > 0 {
+		beads = min(beads, m.options.MaxBeads)
+	}
+	for _, box := range m.UnvisitedBoxes() {
+		if box.frozen {
+			continue
+		}
+		box.totalBeads = 0
+		for mv := range box.beads {
+			box.beads[mv] = beads
+			box.totalBeads += beads
+		}
+	}
+}
+
+// Freeze protects the box for a board from further learning, so that Reward
+// and Punish leave its beads alone while other boxes keep learning. This is
+// useful for keeping a part of MENACE's play, like the opening, that it has
+// already learned well. The beads can still be changed with Box.Tune.
+//
+// Returns an error if there is no box for the board.
+func (m *Menace) Freeze(b game.Board) error {
+	return m.setFrozen(b, true)
+}
+
+// Unfreeze lets the box for a board learn again after Freeze.
+//
+// Returns an error if there is no box for the board.
+func (m *Menace) Unfreeze(b game.Board) error {
+	return m.setFrozen(b, false)
+}
+
+func (m *Menace) setFrozen(b game.Board, frozen bool) error {
+	box := m.Box(b)
+	if box == nil {
+		return fmt.Errorf("no box found for %v", b)
+	}
+	box.frozen = frozen
+	return nil
+}
+
+// ForbidMove removes a move from the box for a board, along with its beads,
+// so that MENACE never plays it again, as a handicap. The move is given in
+// the frame of b, and is transformed into the frame of the box.
+//
+// Returns an error if there is no box for the board, or the box has no such move.
+func (m *Menace) ForbidMove(b game.Board, p game.Position) error {
+	box := m.Box(b)
+	if box == nil {
+		return fmt.Errorf("no box found for %v", b)
+	}
+	tp, ok := boxMove(box, b, p)
+	if !ok {
+		return fmt.Errorf("box for %v has no move matching %v", b, p)
+	}
+	box.totalBeads -= box.beads[tp]
+	delete(box.beads, tp)
+	delete(box.nexts, tp)
 	return nil
 }
 
@@ -227,14 +953,18 @@ type Box struct {
 	totalBeads int
 	beads      map[game.Position]int
 	nexts      map[game.Position]*Box
+	options    *Options // options of the MENACE instance that owns this box
+	visited    bool     // whether MENACE has drawn from or tuned this box
+	frozen     bool     // whether rewards and punishments leave this box alone
 }
 
-func newBox(gm game.Game) Box {
+func newBox(gm game.Game, options *Options) Box {
 	return Box{
 		game:       gm,
 		totalBeads: 0,
 		beads:      make(map[game.Position]int),
 		nexts:      make(map[game.Position]*Box),
+		options:    options,
 	}
 }
 
@@ -255,38 +985,330 @@ func (b *Box) Beads() map[game.Position]int {
 }
 
 // Nexts returns a mapping of legal moves to the box that results
-// from that move.
+// from that move. With Options.Lazy, moves to boxes that haven't
+// been linked yet are left out.
 func (b *Box) Nexts() map[game.Position]*Box {
 	return maps.Clone(b.nexts)
 }
 
+// Visited checks whether MENACE has made a move from this box,
+// or had its beads adjusted by a reward or punishment, since the stats were last reset.
+func (b *Box) Visited() bool {
+	return b.visited
+}
+
+// Frozen checks whether the box is protected from rewards and punishments.
+// See Menace.Freeze.
+func (b *Box) Frozen() bool {
+	return b.frozen
+}
+
+// moves lists the moves in the box in row-major order.
+func (b *Box) moves() []game.Position {
+	return slices.SortedFunc(maps.Keys(b.beads), func(p, q game.Position) int {
+		return cmp.Or(cmp.Compare(p.Row, q.Row), cmp.Compare(p.Col, q.Col))
+	})
+}
+
+// Favored returns the move with the most beads in the box, and its beads,
+// choosing the earliest position in row-major order for ties. This is the move
+// played by Menace.BestMove, in the frame of the box's game state.
+// Returns false if the box has no beads.
+func (b *Box) Favored() (mv game.Position, beads int, ok bool) {
+	if b.totalBeads == 0 {
+		return game.Position{}, 0, false
+	}
+	mv = mostBeads(b)
+	return mv, b.beads[mv], true
+}
+
+// Disfavored returns the move with the fewest beads in the box, and its beads,
+// choosing the earliest position in row-major order for ties.
+// Returns false if the box has no beads.
+func (b *Box) Disfavored() (mv game.Position, beads int, ok bool) {
+	if b.totalBeads == 0 {
+		return game.Position{}, 0, false
+	}
+	moves := b.moves()
+	mv = moves[0]
+	for _, other := range moves[1:] {
+		if b.beads[other] < b.beads[mv] {
+			mv = other
+		}
+	}
+	return mv, b.beads[mv], true
+}
+
+// BeadsForProbability finds how many beads to add to a move in the box (or remove,
+// if negative) so that it has at least the target probability of being drawn,
+// given the beads for the other moves. The move is in the frame of the box's
+// game state. The result can be passed to Tune.
+//
+// Returns an error if the box has no such move, or if the target can't be reached:
+// it is not between 0 and 1, it is 1 and other moves have beads, or it would take
+// more than Options.MaxBeads.
+func (b *Box) BeadsForProbability(p game.Position, target float64) (int, error) {
+	beads, ok := b.beads[p]
+	if !ok {
+		return 0, fmt.Errorf("box for %v has no move %v", b.game, p)
+	}
+	if target < 0 || target > 1 {
+		return 0, fmt.Errorf("probability %v is not between 0 and 1", target)
+	}
+	others := b.totalBeads - beads
+	if target == 0 {
+		return -beads, nil
+	}
+	if others == 0 {
+		return max(1-beads, 0), nil
+	}
+	if target == 1 {
+		return 0, fmt.Errorf("other moves in box for %v have beads", b.game)
+	}
+	// Solve n / (n + others) >= target for the fewest beads n, correcting
+	// for any rounding in the division.
+	n := int(math.Ceil(target * float64(others) / (1 - target)))
+	for n > 0 && float64(n-1)/float64(n-1+others) >= target {
+		n--
+	}
+	if most := b.options.MaxBeads; most > 0 && n > most {
+		return 0, fmt.Errorf("probability %v needs %d beads, more than the most of %d", target, n, most)
+	}
+	return n - beads, nil
+}
+
+// DistinctMoves groups the legal moves from the box's game state into moves that
+// are transformations of each other on this board, such as the four corners of
+// an empty board. The box only holds beads for one move from each group, which is
+// why MENACE has 3 choices for its opening, not 9. Groups are in row-major order
+// of their first move, and moves in each group are in row-major order. Moves are
+// in the frame of the box's game state.
+func (b *Box) DistinctMoves() [][]game.Position {
+	var (
+		bb      = b.game.Board()
+		grouped = make(map[game.Position]bool)
+		groups  [][]game.Position
+	)
+	for _, mv := range b.game.Moves() {
+		if grouped[mv] {
+			continue
+		}
+		var group []game.Position
+		for rots := range game.Rotations {
+			for _, t := range [...]bool{false, true} {
+				if tmv := mv.Transform(rots, t); bb.Transform(rots, t) == bb && !grouped[tmv] {
+					grouped[tmv] = true
+					group = append(group, tmv)
+				}
+			}
+		}
+		slices.SortFunc(group, func(p, q game.Position) int {
+			return cmp.Or(cmp.Compare(p.Row, q.Row), cmp.Compare(p.Col, q.Col))
+		})
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+// Entropy measures how undecided the box is, as the Shannon entropy
+// (in bits) of the probabilities of drawing each move's beads.
+//
+// It is 0 when one move holds all of the beads, and largest when
+// the beads are spread evenly. An empty box has an entropy of 0.
+func (b *Box) Entropy() float64 {
+	var entropy float64
+	for _, beads := range b.beads {
+		if beads == 0 {
+			continue
+		}
+		p := float64(beads) / float64(b.totalBeads)
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+// SameBoard checks whether two boxes, possibly from different instances of MENACE,
+// are for game states that are transformations of each other, and hold the same
+// beads for the same moves once transformed to match.
+func (b *Box) SameBoard(other *Box) bool {
+	var (
+		bb = b.game.Board()
+		ob = other.game.Board()
+	)
+	if b.game.Turn() != other.game.Turn() || bb.Canonical() != ob.Canonical() {
+		return false
+	}
+	if len(b.beads) != len(other.beads) || b.totalBeads != other.totalBeads {
+		return false
+	}
+	for mv, beads := range b.beads {
+		omv, ok := boxMove(other, bb, mv)
+		if !ok || other.beads[omv] != beads {
+			return false
+		}
+	}
+	return true
+}
+
+// maxTotalBeads is the most beads a box can hold, so that counting them never overflows.
+const maxTotalBeads = math.MaxInt
+
 // Tune adjusts the number of beads in boxes. It ensures only
-// legal moves have beads, and that beads do not go negative.
-func (b *Box) Tune(beads map[game.Position]int) {
+// legal moves have beads, that beads do not go negative, and that
+// beads do not exceed Options.MaxBeads, if set. The beads in the box
+// are also kept within the largest int, rather than overflowing.
+//
+// Returns true if beads were held back by either limit.
+func (b *Box) Tune(beads map[game.Position]int) (clamped bool) {
 	for mv, delta := range beads {
 		if _, ok := b.beads[mv]; ok {
 			capped := max(delta, -b.beads[mv])
+			if b.options.MaxBeads > 0 {
+				capped = min(capped, b.options.MaxBeads-b.beads[mv])
+			}
+			capped = min(capped, maxTotalBeads-b.totalBeads)
+			clamped = clamped || capped < delta && delta > 0
 			b.beads[mv] += capped
 			b.totalBeads += capped
 		}
 	}
+	return clamped
 }
 
+// layerCount is the number of layers of boxes for unfinished games,
+// where layer i holds the boxes with i symbols on the board.
+const layerCount = game.BoardDim * game.BoardDim
+
 // Options controls MENACE's bead management.
 type Options struct {
-	Beads      [9]int // beads per move, depending on layer (0=start)
-	WinReward  int    // beads added for MENACE's winning moves
-	DrawReward int    // beads added for MENACE's drawing moves
+	Beads      [layerCount]int // beads per move, depending on layer (0=start)
+	WinReward  int             // beads added for MENACE's winning moves
+	DrawReward int             // beads added for MENACE's drawing moves, or removed if negative
+	MaxBeads   int             // most beads a move can have, or 0 for no limit
+
+	// RecentGames is the number of most recent outcomes kept for Menace.RecentWinRate.
+	RecentGames int
+
+	// SampleInterval is the number of outcomes between samples of MENACE's stats,
+	// kept for Menace.Samples. Zero means no samples are kept.
+	SampleInterval int
+
+	// Rule decides which player wins a game with a line of three,
+	// and so which moves are rewarded and which are punished.
+	Rule game.Rule
+
+	// DrawRewardFunc, if not nil, replaces DrawReward, so that draws can be rewarded
+	// based on how long MENACE held out. It receives the number of symbols on the board
+	// after MENACE's last move, and returns the beads to add for MENACE's drawing moves,
+	// which may be negative like DrawReward.
+	DrawRewardFunc func(moveCount int) int `json:"-"`
+
+	// ResignValue, if not 0, makes MENACE resign when it is losing against perfect play
+	// and its own estimate of the position (see Menace.BoxValue) is below ResignValue,
+	// rather than only when its box is empty. It ranges from -1 to 0, where values
+	// closer to -1 make MENACE hold out longer. Perfect play is judged under standard
+	// rules, so this has no effect under misère play.
+	ResignValue float64
+
+	// LengthNormalize, if true, spreads each reward or punishment across MENACE's moves
+	// in the game rather than giving it to every move, so that long games don't shift
+	// more beads than short ones. Since beads are whole, moves in games longer than
+	// the reward may get nothing, with the remainder going to the latest moves.
+	LengthNormalize bool
+
+	// CreditFinalK, if not 0, limits each reward or punishment to the last CreditFinalK
+	// moves MENACE made in the game, which are closest to the outcome, leaving its earlier
+	// moves alone. With LengthNormalize, the reward is spread across only those moves.
+	CreditFinalK int
+
+	// GreedyAfter, if not 0, makes MENACE stop drawing beads at random from boxes with
+	// more than GreedyAfter beads, and play the move with the most beads instead, as in
+	// Menace.BestMove. This way MENACE explores positions it has little experience of,
+	// but settles on what it has learned elsewhere.
+	GreedyAfter int
+
+	// Lazy, if true, makes New create only the box for the empty board, and
+	// Menace.Box create the others when they are first needed, rather than building
+	// every box up front. This saves memory when only some lines are ever played,
+	// at the cost of slower first lookups. Methods that look at all of MENACE's
+	// boxes, like Menace.Coverage, only see the boxes created so far.
+	Lazy bool
+
+	// Seed, if not 0, seeds MENACE's own source of random choices when drawing beads,
+	// so that the same seed makes the same moves in the same boxes. Otherwise,
+	// the shared source in math/rand is used. Opponents have their own randomness.
+	Seed int64
+}
+
+// validate checks that options are usable by MENACE, joining together
+// errors for each invalid option.
+func (o Options) validate() error {
+	var errs []error
+	for i, b := range o.Beads {
+		if b < 1 {
+			errs = append(errs, fmt.Errorf("beads for layer %d < 1", i))
+		}
+	}
+	if o.WinReward < 0 {
+		errs = append(errs, fmt.Errorf("win reward is negative"))
+	}
+	if o.DrawReward > o.WinReward {
+		errs = append(errs, fmt.Errorf("draw reward %d exceeds win reward %d", o.DrawReward, o.WinReward))
+	}
+	if o.RecentGames < 0 {
+		errs = append(errs, fmt.Errorf("recent games is negative"))
+	}
+	if o.SampleInterval < 0 {
+		errs = append(errs, fmt.Errorf("sample interval is negative"))
+	}
+	if o.GreedyAfter < 0 {
+		errs = append(errs, fmt.Errorf("greedy threshold is negative"))
+	}
+	if o.CreditFinalK < 0 {
+		errs = append(errs, fmt.Errorf("credited moves is negative"))
+	}
+	if o.ResignValue < -1 || o.ResignValue > 0 {
+		errs = append(errs, fmt.Errorf("resign value %v is not between -1 and 0", o.ResignValue))
+	}
+	if o.MaxBeads < 0 {
+		errs = append(errs, fmt.Errorf("max beads is negative"))
+	} else if o.MaxBeads > 0 {
+		for i, b := range o.Beads {
+			if b > o.MaxBeads {
+				errs = append(errs, fmt.Errorf("beads for layer %d exceed max beads %d", i, o.MaxBeads))
+			}
+		}
+	}
+	return errors.Join(errs...)
 }
 
 // DefaultOptions returns the default MENACE bead controls.
 //
 // Beads:  [5 5 4 4 3 3 2 2 1]
 // Reward: 3
+// Recent games: 1000
+// Sample interval: 1000
 func DefaultOptions() Options {
 	return Options{
-		[...]int{4, 4, 3, 3, 2, 2, 1, 1, 1},
-		3,
-		1,
+		Beads:          [...]int{4, 4, 3, 3, 2, 2, 1, 1, 1},
+		WinReward:      3,
+		DrawReward:     1,
+		RecentGames:    1000,
+		SampleInterval: 1000,
+	}
+}
+
+// UniformOptions returns the default options (see DefaultOptions), but with the same
+// number of beads for every layer, and the given rewards. This is common in MENACE
+// variants where bead counts don't taper off for later moves.
+//
+// As with any options, New rejects beads less than 1.
+func UniformOptions(beads, winReward, drawReward int) Options {
+	options := DefaultOptions()
+	for i := range options.Beads {
+		options.Beads[i] = beads
 	}
+	options.WinReward = winReward
+	options.DrawReward = drawReward
+	return options
 }
@@ -0,0 +1,120 @@
+package menace
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/adambyle/menace/game"
+)
+
+// ImportMichie creates an instance of MENACE with the default options
+// (see DefaultOptions) and bead counts read from a text listing of matchboxes,
+// such as the configurations in Donald Michie's description of MENACE.
+//
+// Each box is a block of lines: a board in any format accepted by
+// game.ParseBoard, followed by one line per move with a position in any
+// format accepted by game.ParsePosition and a bead count, separated by
+// a space or a colon. Blocks are separated by blank lines, and lines
+// starting with # are comments.
+//
+//	# Opening box
+//	.../.../...
+//	0,0: 4
+//	0,1: 4
+//	1,1: 4
+//
+// Boards are matched to MENACE's boxes up to transformation, just as Michie
+// counted symmetric positions as one matchbox, and moves are transformed to match.
+// Moves that are not listed keep their default beads, as do boxes that are not listed.
+//
+// Returns an error naming the line if a board is not a legal, unfinished game,
+// if a move is illegal or listed twice, or if a bead count is not positive.
+func ImportMichie(r io.Reader) (Menace, error) {
+	m := Default()
+	var (
+		sc     = bufio.NewScanner(r)
+		n      int                   // line number
+		gm     game.Game             // game state of the current block
+		box    *Box                  // box of the current block, or nil between blocks
+		seen   map[game.Position]int // lines of the moves in the current block, by box move
+		listed = make(map[*Box]bool) // boxes that already have a block
+	)
+	for sc.Scan() {
+		n++
+		line := strings.TrimSpace(sc.Text())
+		switch {
+		case strings.HasPrefix(line, "#"):
+			continue
+		case line == "":
+			box = nil
+			continue
+		case box == nil:
+			b, err := game.ParseBoard(line)
+			if err != nil {
+				return Menace{}, fmt.Errorf("line %d: %w", n, err)
+			}
+			if gm, err = game.FromBoard(b); err != nil {
+				return Menace{}, fmt.Errorf("line %d: %w", n, err)
+			}
+			if gm.Completed() {
+				return Menace{}, fmt.Errorf("line %d: board %v is a finished game", n, b)
+			}
+			box = m.Box(b)
+			if box == nil {
+				return Menace{}, fmt.Errorf("line %d: no box found for %v", n, b)
+			}
+			if listed[box] {
+				return Menace{}, fmt.Errorf("line %d: board %v is already listed", n, b)
+			}
+			listed[box] = true
+			seen = make(map[game.Position]int)
+			continue
+		}
+		mv, beads, err := parseMichieMove(line)
+		if err != nil {
+			return Menace{}, fmt.Errorf("line %d: %w", n, err)
+		}
+		if _, err := gm.Move(mv); err != nil {
+			return Menace{}, fmt.Errorf("line %d: %w", n, err)
+		}
+		bmv, ok := boxMove(box, gm.Board(), mv)
+		if !ok {
+			panic("legal move has no equivalent in its box")
+		}
+		if prev, ok := seen[bmv]; ok {
+			return Menace{}, fmt.Errorf("line %d: move %v is the same as the move on line %d", n, mv, prev)
+		}
+		seen[bmv] = n
+		box.totalBeads += beads - box.beads[bmv]
+		box.beads[bmv] = beads
+	}
+	if err := sc.Err(); err != nil {
+		return Menace{}, err
+	}
+	return m, nil
+}
+
+// parseMichieMove reads a move line for ImportMichie: a position, then a positive
+// bead count, separated by a colon or by the last space.
+func parseMichieMove(line string) (game.Position, int, error) {
+	i := strings.LastIndexAny(line, ": \t")
+	if i < 0 {
+		return game.Position{}, 0, fmt.Errorf("move %q has no bead count", line)
+	}
+	mv, err := game.ParsePosition(strings.TrimRight(line[:i], ": \t"))
+	if err != nil {
+		return game.Position{}, 0, err
+	}
+	count := strings.TrimSpace(line[i+1:])
+	beads, err := strconv.Atoi(count)
+	if err != nil {
+		return game.Position{}, 0, fmt.Errorf("bead count %q is not a number", count)
+	}
+	if beads < 1 {
+		return game.Position{}, 0, fmt.Errorf("bead count %d is not positive", beads)
+	}
+	return mv, beads, nil
+}
@@ -0,0 +1,67 @@
+package menace
+
+import (
+	"cmp"
+	"encoding/csv"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/adambyle/menace/game"
+)
+
+// AttachMoveLog starts logging every move MENACE learns from to w as CSV,
+// with a header row. Each row has the board before the move (in a format
+// accepted by game.ParseBoard), the player who moved, the move, and the outcome
+// of the game for that player: "won", "drew", or "lost".
+//
+//	board,turn,move,outcome
+//	.../.../...,X,"1,1",won
+//
+// Rows are written once the game's outcome is known, when the moves are passed
+// to Reward or Punish, and are flushed after each game. Attaching a new log
+// replaces the old one without flushing it; see Menace.DetachMoveLog.
+func (m *Menace) AttachMoveLog(w io.Writer) {
+	m.record.moveLog = csv.NewWriter(w)
+	m.record.moveLog.Write([]string{"board", "turn", "move", "outcome"})
+}
+
+// DetachMoveLog stops logging moves, and returns the first error that
+// happened while writing the log, if any.
+func (m *Menace) DetachMoveLog() error {
+	cw := m.record.moveLog
+	if cw == nil {
+		return nil
+	}
+	m.record.moveLog = nil
+	cw.Flush()
+	return cw.Error()
+}
+
+// logMoves writes a row for each of the moves of a finished game to the move log,
+// if one is attached, in the order they were made.
+func (m Menace) logMoves(moves map[game.Game]game.Position, o outcome) {
+	cw := m.record.moveLog
+	if cw == nil {
+		return
+	}
+	games := slices.SortedFunc(maps.Keys(moves), func(a, b game.Game) int {
+		return cmp.Compare(a.SpacesFilled(), b.SpacesFilled())
+	})
+	for _, gm := range games {
+		cw.Write([]string{
+			slashBoard(gm.Board()),
+			gm.Turn().String(),
+			moves[gm].String(),
+			o.String(),
+		})
+	}
+	cw.Flush()
+}
+
+// slashBoard formats a board with its rows separated by slashes, as in "X../.O./...".
+func slashBoard(b game.Board) string {
+	rows := strings.Fields(strings.Trim(b.String(), "[]"))
+	return strings.Join(rows, "/")
+}
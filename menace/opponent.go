@@ -0,0 +1,112 @@
+package menace
+
+import (
+	"math/rand"
+	"slices"
+
+	"github.com/adambyle/menace/game"
+)
+
+// Opponent chooses moves to play against MENACE in training.
+//
+// Move is only called for playable games, and must return a legal move.
+type Opponent interface {
+	Move(game.Game) game.Position
+}
+
+// RandomOpponent plays any legal move at random.
+type RandomOpponent struct{}
+
+func (RandomOpponent) Move(gm game.Game) game.Position {
+	moves := gm.Moves()
+	return moves[rand.Intn(len(moves))]
+}
+
+// HeuristicOpponent plays by simple rules of thumb: make a line if possible,
+// otherwise block the other player's line, otherwise take the center,
+// then a corner, then an edge.
+type HeuristicOpponent struct{}
+
+func (HeuristicOpponent) Move(gm game.Game) game.Position {
+	var (
+		b     = gm.Board()
+		moves = gm.Moves()
+	)
+	for _, s := range [...]game.Symbol{gm.Turn(), gm.Turn().Other()} {
+		for _, mv := range moves {
+			if completesLine(b, mv, s) {
+				return mv
+			}
+		}
+	}
+	const last = game.BoardDim - 1
+	preferred := []game.Position{
+		{Row: last / 2, Col: last / 2},
+		{Row: 0, Col: 0}, {Row: 0, Col: last}, {Row: last, Col: 0}, {Row: last, Col: last},
+	}
+	for _, mv := range preferred {
+		if b[mv.Row][mv.Col] == game.Empty {
+			return mv
+		}
+	}
+	return moves[rand.Intn(len(moves))]
+}
+
+// completesLine checks whether placing s at mv would make a line of s.
+func completesLine(b game.Board, mv game.Position, s game.Symbol) bool {
+	b[mv.Row][mv.Col] = s
+lines:
+	for _, line := range b.Lines() {
+		if !slices.Contains(line[:], mv) {
+			continue
+		}
+		for _, p := range line {
+			if b[p.Row][p.Col] != s {
+				continue lines
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// MinimaxOpponent plays perfectly, choosing at random among the best moves.
+// See game.Game.BestMoves.
+type MinimaxOpponent struct{}
+
+func (MinimaxOpponent) Move(gm game.Game) game.Position {
+	moves := gm.BestMoves()
+	return moves[rand.Intn(len(moves))]
+}
+
+// noisyOpponent is the opponent returned by NoisyOpponent.
+type noisyOpponent struct {
+	base        Opponent
+	mistakeRate float64
+	r           *rand.Rand
+}
+
+// NoisyOpponent returns an opponent that plays like base, except that it plays
+// a random legal move instead with a chance of mistakeRate. Lowering the rate
+// over the course of training makes the opponent harder as MENACE improves.
+//
+// Random choices come from r, or from the shared source in math/rand if r is nil.
+// Panics if mistakeRate is not between 0 and 1.
+func NoisyOpponent(base Opponent, mistakeRate float64, r *rand.Rand) Opponent {
+	if mistakeRate < 0 || mistakeRate > 1 {
+		panic("mistake rate is not between 0 and 1")
+	}
+	return noisyOpponent{base, mistakeRate, r}
+}
+
+func (o noisyOpponent) Move(gm game.Game) game.Position {
+	chance, pick := rand.Float64, rand.Intn
+	if o.r != nil {
+		chance, pick = o.r.Float64, o.r.Intn
+	}
+	if o.mistakeRate == 0 || chance() >= o.mistakeRate {
+		return o.base.Move(gm)
+	}
+	moves := gm.Moves()
+	return moves[pick(len(moves))]
+}
@@ -0,0 +1,44 @@
+package menace
+
+import "github.com/adambyle/menace/game"
+
+// Outcome describes how a game ended from MENACE's point of view.
+type Outcome struct {
+	// Winner is the winning player, Cat for a draw, or Empty for an unfinished
+	// game. If MENACE resigned, its opponent is the winner.
+	Winner game.Symbol
+
+	MenaceWon      bool // whether MENACE won
+	Draw           bool // whether the game was drawn
+	MenaceResigned bool // whether MENACE gave up before the game was over
+
+	// Moves is the number of symbols on the board when the game ended.
+	Moves int
+}
+
+// ClassifyOutcome describes the end of a game in which MENACE played menaceSide,
+// under standard rules. If resigned is true, MENACE resigned in gm, and lost.
+// See Menace.ClassifyOutcome for MENACE's own rule.
+func ClassifyOutcome(gm game.Game, menaceSide game.Symbol, resigned bool) Outcome {
+	return classifyOutcome(gm, gm.Winner(), menaceSide, resigned)
+}
+
+// ClassifyOutcome describes the end of a game like the package-level ClassifyOutcome,
+// but decides the winner under the rule MENACE is trained for. See Options.Rule.
+func (m Menace) ClassifyOutcome(gm game.Game, menaceSide game.Symbol, resigned bool) Outcome {
+	return classifyOutcome(gm, m.Winner(gm), menaceSide, resigned)
+}
+
+// classifyOutcome fills in an outcome for a game with the given winner.
+func classifyOutcome(gm game.Game, winner, menaceSide game.Symbol, resigned bool) Outcome {
+	if resigned {
+		winner = menaceSide.Other()
+	}
+	return Outcome{
+		Winner:         winner,
+		MenaceWon:      winner == menaceSide,
+		Draw:           winner == game.Cat,
+		MenaceResigned: resigned,
+		Moves:          gm.SpacesFilled(),
+	}
+}
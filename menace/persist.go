@@ -0,0 +1,109 @@
+package menace
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/adambyle/menace/game"
+)
+
+// savedBox is the JSON shape of a box.
+type savedBox struct {
+	Board  game.Board            `json:"board"`
+	Beads  map[game.Position]int `json:"beads"`
+	Frozen bool                  `json:"frozen,omitempty"`
+}
+
+// savedMenace is the JSON shape of a MENACE instance.
+type savedMenace struct {
+	Options Options    `json:"options"`
+	Boxes   []savedBox `json:"boxes"`
+}
+
+// Save writes MENACE's options, the beads in every box, and which boxes
+// are frozen as JSON, so that training can be resumed later with Load.
+//
+// Options.DrawRewardFunc and stats are not saved.
+func (m Menace) Save(w io.Writer) error {
+	saved := savedMenace{Options: *m.options}
+	for _, box := range m.sortedBoxes() {
+		saved.Boxes = append(saved.Boxes, savedBox{box.game.Board(), box.beads, box.frozen})
+	}
+	return json.NewEncoder(w).Encode(saved)
+}
+
+// Load reads a MENACE instance written by Save. Boxes are matched to
+// the boxes of a new instance by board, up to transformation. Moves missing
+// from a saved box are forbidden, as with Menace.ForbidMove.
+//
+// Returns an error if the saved options are invalid, or if a saved box
+// has no match or has moves that don't match its box.
+func Load(r io.Reader) (Menace, error) {
+	var saved savedMenace
+	if err := json.NewDecoder(r).Decode(&saved); err != nil {
+		return Menace{}, err
+	}
+	menace, err := New(saved.Options)
+	if err != nil {
+		return Menace{}, err
+	}
+	for _, sb := range saved.Boxes {
+		box := menace.Box(sb.Board)
+		if box == nil {
+			return Menace{}, fmt.Errorf("no box found for %v", sb.Board)
+		}
+		rots, t, ok := box.game.Board().Transformation(sb.Board)
+		if !ok {
+			panic("Menace.Box() returned unmatching game state")
+		}
+		box.frozen = sb.Frozen
+		box.totalBeads = 0
+		saved := make(map[game.Position]bool, len(sb.Beads))
+		for mv, beads := range sb.Beads {
+			tmv := mv.Transform(rots, t)
+			if _, ok := box.beads[tmv]; !ok {
+				return Menace{}, fmt.Errorf("box for %v has no move %v", sb.Board, mv)
+			}
+			if beads < 0 {
+				return Menace{}, fmt.Errorf("box for %v has negative beads for %v", sb.Board, mv)
+			}
+			if beads > maxTotalBeads-box.totalBeads {
+				return Menace{}, fmt.Errorf("box for %v has too many beads", sb.Board)
+			}
+			box.beads[tmv] = beads
+			box.totalBeads += beads
+			saved[tmv] = true
+		}
+		// Moves missing from the saved box were forbidden.
+		for mv := range box.beads {
+			if !saved[mv] {
+				delete(box.beads, mv)
+				delete(box.nexts, mv)
+			}
+		}
+	}
+	return menace, nil
+}
+
+// Save writes the options as JSON, so that the same options can be shared
+// between instances of MENACE with LoadOptions.
+//
+// DrawRewardFunc is not saved.
+func (o Options) Save(w io.Writer) error {
+	return json.NewEncoder(w).Encode(o)
+}
+
+// LoadOptions reads options written by Options.Save.
+//
+// Returns an error if the options are invalid, just as New would.
+func LoadOptions(r io.Reader) (Options, error) {
+	var options Options
+	if err := json.NewDecoder(r).Decode(&options); err != nil {
+		return Options{}, err
+	}
+	if err := options.validate(); err != nil {
+		return Options{}, err
+	}
+	return options, nil
+}
@@ -0,0 +1,197 @@
+package menace
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/adambyle/menace/game"
+)
+
+// Replay is the sequence of moves made in a game, starting from an empty board.
+type Replay []game.Position
+
+// Game plays the moves of the replay from an empty board and returns
+// the resulting game state. Returns an error if any move is illegal.
+func (r Replay) Game() (game.Game, error) {
+	gm := game.New()
+	for _, mv := range r {
+		next, err := gm.Move(mv)
+		if err != nil {
+			return game.Game{}, err
+		}
+		gm = next
+	}
+	return gm, nil
+}
+
+// Reverse returns every game state in the replay from the last back to
+// the empty board, for stepping back through how a game was reached.
+// Returns an error if any move is illegal.
+func (r Replay) Reverse() ([]game.Game, error) {
+	states := []game.Game{game.New()}
+	for _, mv := range r {
+		next, err := states[len(states)-1].Move(mv)
+		if err != nil {
+			return nil, err
+		}
+		states = append(states, next)
+	}
+	slices.Reverse(states)
+	return states, nil
+}
+
+// Walk steps through the replay, calling fn with the index of each move,
+// the game state before it, and the move itself. Walking stops early
+// if fn returns false.
+//
+// Walking also stops at the first illegal move, without calling fn for it.
+// Since there is no way to report this, check that a replay is legal
+// with Replay.Game before walking it.
+func (r Replay) Walk(fn func(step int, g game.Game, mv game.Position) bool) {
+	gm := game.New()
+	for i, mv := range r {
+		next, err := gm.Move(mv)
+		if err != nil || !fn(i, gm, mv) {
+			return
+		}
+		gm = next
+	}
+}
+
+// Notation writes the replay as a list of moves separated by spaces, each as
+// a column letter and a row number, starting from a1 in the top left corner.
+// For example, "b2 a1 c3" is X in the center, O in the top left corner,
+// then X in the bottom right corner. See ParseGameNotation.
+func (r Replay) Notation() string {
+	moves := make([]string, len(r))
+	for i, mv := range r {
+		moves[i] = string(rune('a'+mv.Col)) + strconv.Itoa(mv.Row+1)
+	}
+	return strings.Join(moves, " ")
+}
+
+// ParseGameNotation reads a replay written as in Replay.Notation.
+// Column letters may be upper or lower case.
+//
+// Returns an error if a move is not in the notation or is illegal.
+func ParseGameNotation(s string) (Replay, error) {
+	var r Replay
+	for i, field := range strings.Fields(strings.ToLower(s)) {
+		row, err := strconv.Atoi(field[1:])
+		if err != nil {
+			return nil, fmt.Errorf("move %d: invalid move %q", i+1, field)
+		}
+		mv := game.Position{Row: row - 1, Col: int(field[0] - 'a')}
+		if err := mv.Valid(); err != nil {
+			return nil, fmt.Errorf("move %d: invalid move %q: %w", i+1, field, err)
+		}
+		r = append(r, mv)
+	}
+	if _, err := r.Game(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// ReplayBuffer keeps a uniform random sample of the replays added to it,
+// up to a fixed capacity, using reservoir sampling.
+type ReplayBuffer struct {
+	replays  []Replay
+	capacity int
+	seen     int // number of replays ever added
+}
+
+// NewReplayBuffer creates an empty buffer that holds up to capacity replays.
+func NewReplayBuffer(capacity int) *ReplayBuffer {
+	return &ReplayBuffer{
+		replays:  make([]Replay, 0, capacity),
+		capacity: capacity,
+	}
+}
+
+// Add offers a replay to the buffer. Once the buffer is full, the replay
+// replaces a random replay in the buffer with a chance of capacity/n,
+// where n is the number of replays ever added, so every replay added
+// is equally likely to be in the buffer.
+func (rb *ReplayBuffer) Add(r Replay) {
+	rb.seen++
+	if len(rb.replays) < rb.capacity {
+		rb.replays = append(rb.replays, r)
+		return
+	}
+	if i := rand.Intn(rb.seen); i < rb.capacity {
+		rb.replays[i] = r
+	}
+}
+
+// Len returns the number of replays in the buffer.
+func (rb *ReplayBuffer) Len() int {
+	return len(rb.replays)
+}
+
+// Sample draws up to n different replays from the buffer at random.
+func (rb *ReplayBuffer) Sample(n int) []Replay {
+	n = min(n, len(rb.replays))
+	sample := make([]Replay, n)
+	for i, j := range rand.Perm(len(rb.replays))[:n] {
+		sample[i] = rb.replays[j]
+	}
+	return sample
+}
+
+// AttachReplayBuffer starts keeping a sample of the games MENACE plays in training,
+// in a new ReplayBuffer holding up to capacity replays. A capacity of 0 stops
+// keeping replays.
+func (m *Menace) AttachReplayBuffer(capacity int) {
+	if capacity <= 0 {
+		m.record.replays = nil
+		return
+	}
+	m.record.replays = NewReplayBuffer(capacity)
+}
+
+// ReplaySample draws up to n different replays at random from the games MENACE has
+// played in training since a replay buffer was attached. See Menace.AttachReplayBuffer.
+func (m *Menace) ReplaySample(n int) []Replay {
+	if m.record.replays == nil {
+		return nil
+	}
+	return m.record.replays.Sample(n)
+}
+
+// keep adds a replay of a training game to the replay buffer, if one is attached.
+func (m *Menace) keep(r Replay) {
+	if m.record.replays != nil {
+		m.record.replays.Add(r)
+	}
+}
+
+// LearnFromReplay learns from a past game again, from the moves of both players,
+// as MENACE does from games against itself (see Menace.TrainSelfContext). A replay
+// that ends before the game is over is taken as a resignation by the player to move,
+// whose moves are punished. Replayed games count towards MENACE's stats like any other.
+//
+// Returns an error if the replay has an illegal move, without learning anything.
+func (m *Menace) LearnFromReplay(r Replay) error {
+	gm, err := r.Game()
+	if err != nil {
+		return fmt.Errorf("illegal move in replay: %w", err)
+	}
+	mvs := map[game.Symbol]map[game.Game]game.Position{
+		game.X: {},
+		game.O: {},
+	}
+	r.Walk(func(_ int, g game.Game, mv game.Position) bool {
+		mvs[g.Turn()][g] = mv
+		return true
+	})
+	if !gm.Completed() {
+		m.Punish(mvs[gm.Turn()])
+		return nil
+	}
+	m.ApplyOutcome(mvs[game.X], mvs[game.O], m.Winner(gm))
+	return nil
+}
@@ -0,0 +1,184 @@
+package menace
+
+import (
+	"encoding/csv"
+	"io"
+	"slices"
+	"strconv"
+
+	"github.com/adambyle/menace/game"
+)
+
+// Stats counts the game outcomes MENACE has been rewarded or punished for.
+type Stats struct {
+	Wins, Draws, Losses int
+}
+
+// Games returns the total number of outcomes counted.
+func (s Stats) Games() int {
+	return s.Wins + s.Draws + s.Losses
+}
+
+// outcome is the result of a game from MENACE's perspective.
+type outcome byte
+
+const (
+	lost outcome = iota
+	drew
+	won
+)
+
+func (o outcome) String() string {
+	switch o {
+	case won:
+		return "won"
+	case drew:
+		return "drew"
+	default:
+		return "lost"
+	}
+}
+
+// record keeps track of MENACE's training history.
+// It is shared by copies of the same Menace.
+type record struct {
+	stats           Stats
+	samples         []Sample      // stats recorded every Options.SampleInterval outcomes
+	replays         *ReplayBuffer // sample of training games, if attached
+	moveLog         *csv.Writer   // log of every move MENACE learns from, if attached
+	decisions       []BoxTrace    // beads MENACE drew from, if recording them
+	recordDecisions bool          // whether to record decisions
+	resignations    []game.Board  // boards where MENACE resigned
+	recent          []outcome     // ring buffer of the most recent outcomes
+	next            int           // index in recent for the next outcome
+	filled          int           // number of outcomes in recent
+}
+
+func newRecord(window int) *record {
+	return &record{recent: make([]outcome, window)}
+}
+
+// add counts an outcome in the lifetime totals and the recent outcomes.
+func (r *record) add(o outcome) {
+	switch o {
+	case won:
+		r.stats.Wins++
+	case drew:
+		r.stats.Draws++
+	default:
+		r.stats.Losses++
+	}
+	if len(r.recent) == 0 {
+		return
+	}
+	r.recent[r.next] = o
+	r.next = (r.next + 1) % len(r.recent)
+	r.filled = min(r.filled+1, len(r.recent))
+}
+
+// observe records the outcome for a mapping of moves passed to Reward or Punish.
+// Empty mappings are not games MENACE played, so they are not counted.
+func (m Menace) observe(moves map[game.Game]game.Position, o outcome) {
+	if len(moves) == 0 {
+		return
+	}
+	m.record.add(o)
+	m.logMoves(moves, o)
+	if interval := m.options.SampleInterval; interval > 0 && m.record.stats.Games()%interval == 0 {
+		m.record.samples = append(m.record.samples, Sample{m.record.stats, m.totalBeads()})
+	}
+}
+
+// totalBeads counts the beads in all of MENACE's boxes.
+func (m Menace) totalBeads() int {
+	total := 0
+	for _, box := range m.boxes {
+		total += box.totalBeads
+	}
+	return total
+}
+
+// Stats returns the totals of the outcomes MENACE has been rewarded or punished for.
+//
+// Every call to Reward or Punish with at least one move counts as one outcome.
+// When MENACE plays itself, both players' outcomes are counted.
+func (m Menace) Stats() Stats {
+	return m.record.stats
+}
+
+// ResetStats clears the outcome totals, recent outcomes, samples, resignations,
+// and which boxes have been visited.
+func (m *Menace) ResetStats() {
+	var (
+		replays, moveLog = m.record.replays, m.record.moveLog
+		decisions, on    = m.record.decisions, m.record.recordDecisions
+	)
+	*m.record = *newRecord(len(m.record.recent))
+	m.record.replays, m.record.moveLog = replays, moveLog
+	m.record.decisions, m.record.recordDecisions = decisions, on
+	for _, box := range m.boxes {
+		box.visited = false
+	}
+}
+
+// RecentWinRate returns the fraction of wins among the last window outcomes.
+// The window is limited to Options.RecentGames, and to the number of outcomes
+// recorded so far. Returns 0 if no outcomes are recorded.
+func (m *Menace) RecentWinRate(window int) float64 {
+	r := m.record
+	window = min(window, r.filled)
+	if window <= 0 {
+		return 0
+	}
+	wins := 0
+	for i := range window {
+		j := (r.next - 1 - i + len(r.recent)) % len(r.recent)
+		if r.recent[j] == won {
+			wins++
+		}
+	}
+	return float64(wins) / float64(window)
+}
+
+// Resignations returns the boards for which MENACE resigned, in the order
+// they happened. These are positions MENACE has given up on, because its box
+// was empty or because it knew it was beaten (see Options.ResignValue).
+func (m *Menace) Resignations() []game.Board {
+	return slices.Clone(m.record.resignations)
+}
+
+// Sample is a snapshot of MENACE's stats during training.
+type Sample struct {
+	Stats
+	TotalBeads int // beads in all boxes
+}
+
+// Samples returns the stats recorded every Options.SampleInterval outcomes.
+func (m *Menace) Samples() []Sample {
+	return slices.Clone(m.record.samples)
+}
+
+// WriteLearningCSV writes the recorded samples (see Menace.Samples) as CSV,
+// with a header row, for plotting how MENACE learned over time.
+//
+//	games,wins,draws,losses,total_beads
+func (m *Menace) WriteLearningCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"games", "wins", "draws", "losses", "total_beads"}); err != nil {
+		return err
+	}
+	for _, s := range m.record.samples {
+		row := []string{
+			strconv.Itoa(s.Games()),
+			strconv.Itoa(s.Wins),
+			strconv.Itoa(s.Draws),
+			strconv.Itoa(s.Losses),
+			strconv.Itoa(s.TotalBeads),
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,278 @@
+package menace
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/adambyle/menace/game"
+)
+
+// TrainSelfContext trains MENACE by playing games against itself, learning
+// from the moves of both players. It stops early if ctx is cancelled,
+// and returns the number of games actually played.
+//
+// Cancellation is only checked between games, so the machine is never
+// left with a game partially learned.
+func (m *Menace) TrainSelfContext(ctx context.Context, games int) int {
+	for i := range games {
+		if ctx.Err() != nil {
+			return i
+		}
+		m.trainSelf()
+	}
+	return games
+}
+
+// trainSelf plays and learns from a single game of MENACE against itself.
+func (m *Menace) trainSelf() {
+	var (
+		gm  = game.New()
+		mvs = map[game.Symbol]map[game.Game]game.Position{
+			game.X: {},
+			game.O: {},
+		}
+		replay Replay
+	)
+	defer func() { m.keep(replay) }()
+	for !gm.Completed() {
+		mv, next, moved, err := m.Move(gm)
+		if err != nil {
+			panic(fmt.Sprint("training failure: ", err))
+		}
+		if !moved {
+			// MENACE resigned.
+			m.Punish(mvs[gm.Turn()])
+			return
+		}
+		mvs[gm.Turn()][gm] = mv
+		replay = append(replay, mv)
+		gm = next
+	}
+	m.ApplyOutcome(mvs[game.X], mvs[game.O], m.Winner(gm))
+}
+
+// TrainAgainst trains MENACE by playing games against an opponent,
+// with MENACE playing menaceSide. Only MENACE's moves are learned from.
+//
+// If bothSides is true, MENACE switches sides after every game, starting
+// as menaceSide, so that over an even number of games it plays X and O equally.
+//
+// Returns an error if the opponent makes an illegal move (see Menace.PlayGame),
+// which stops training. The game it happened in is not learned from.
+func (m *Menace) TrainAgainst(opp Opponent, games int, menaceSide game.Symbol, bothSides bool) error {
+	side := menaceSide
+	for range games {
+		if err := m.trainAgainst(opp, side); err != nil {
+			return err
+		}
+		if bothSides {
+			side = side.Other()
+		}
+	}
+	return nil
+}
+
+// stableDistance is the policy distance between checks below which
+// TrainUntilStable considers MENACE to have stopped learning.
+const stableDistance = 0.01
+
+// TrainUntilStable trains MENACE against an opponent like TrainAgainst, switching
+// sides after every game starting as X, until its play stops changing. Every
+// checkEvery games, MENACE's play is compared to its play at the last check with
+// PolicyDistance, and training stops once the distance is below 0.01. No more than
+// maxGames games are played. Returns the number of games played, which is maxGames
+// if MENACE never stabilized.
+//
+// Returns an error if the opponent makes an illegal move, as in TrainAgainst,
+// along with the number of games played before it.
+// Panics if checkEvery is not positive.
+func (m *Menace) TrainUntilStable(opp Opponent, checkEvery int, maxGames int) (int, error) {
+	if checkEvery <= 0 {
+		panic("check interval is not positive")
+	}
+	var (
+		played int
+		side   = game.X
+	)
+	for played < maxGames {
+		snapshot := m.Clone()
+		for range min(checkEvery, maxGames-played) {
+			if err := m.trainAgainst(opp, side); err != nil {
+				return played, err
+			}
+			side = side.Other()
+			played++
+		}
+		d, err := m.PolicyDistance(snapshot)
+		if err != nil {
+			panic("clone has different boxes")
+		}
+		if d < stableDistance {
+			break
+		}
+	}
+	return played, nil
+}
+
+// TrainWithReplay runs a cycle of training with experience replay: MENACE plays
+// newGames games against an opponent, switching sides after every game starting
+// as X, and keeps them in its replay buffer (see Menace.AttachReplayBuffer). It then
+// learns again from up to replayGames games sampled from the buffer, as in
+// Menace.LearnFromReplay, so that past games keep shaping its play.
+//
+// Returns an error if replayGames is positive but no replay buffer is attached,
+// before playing any games, or if the opponent makes an illegal move, as in TrainAgainst.
+func (m *Menace) TrainWithReplay(newGames, replayGames int, opp Opponent) error {
+	if replayGames > 0 && m.record.replays == nil {
+		return fmt.Errorf("no replay buffer attached")
+	}
+	side := game.X
+	for range newGames {
+		if err := m.trainAgainst(opp, side); err != nil {
+			return err
+		}
+		side = side.Other()
+	}
+	for _, r := range m.ReplaySample(replayGames) {
+		if err := m.LearnFromReplay(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// trainAgainst plays and learns from a single game of MENACE against an opponent.
+func (m *Menace) trainAgainst(opp Opponent, menaceSide game.Symbol) error {
+	_, replay, err := m.PlayGame(opp, menaceSide, true)
+	if err != nil {
+		return err
+	}
+	m.keep(replay)
+	return nil
+}
+
+// PlayGame plays a full game of MENACE against an opponent, with MENACE playing
+// menaceSide, and returns the winner (see Menace.Winner) and the moves made.
+// If MENACE resigns, the opponent is the winner, and the replay ends early.
+//
+// If learn is true, MENACE learns from its moves as in TrainAgainst.
+// Otherwise, MENACE is left unchanged, as with Menace.Suggest.
+//
+// Returns an error naming the opponent and its move if the opponent makes
+// an illegal move, along with the moves made before it. MENACE doesn't learn
+// from a game that ends this way.
+func (m *Menace) PlayGame(opp Opponent, menaceSide game.Symbol, learn bool) (
+	winner game.Symbol, replay Replay, err error,
+) {
+	return m.ResumeGame(opp, menaceSide, learn, nil)
+}
+
+// ResumeGame continues a game of MENACE against an opponent like PlayGame,
+// starting after the moves in start, such as a game saved partway through.
+// The returned replay includes the moves in start, and if learn is true,
+// MENACE learns from its moves in start too.
+//
+// Returns an error if start has an illegal move, or as in PlayGame.
+func (m *Menace) ResumeGame(opp Opponent, menaceSide game.Symbol, learn bool, start Replay) (
+	winner game.Symbol, replay Replay, err error,
+) {
+	gm, err := start.Game()
+	if err != nil {
+		return game.Empty, nil, fmt.Errorf("illegal move in resumed game: %w", err)
+	}
+	mvs := make(map[game.Game]game.Position)
+	start.Walk(func(_ int, g game.Game, mv game.Position) bool {
+		if g.Turn() == menaceSide {
+			mvs[g] = mv
+		}
+		return true
+	})
+	replay = slices.Clone(start)
+	for !gm.Completed() {
+		if gm.Turn() != menaceSide {
+			mv := opp.Move(gm)
+			next, err := gm.Move(mv)
+			if err != nil {
+				return game.Empty, replay, fmt.Errorf("opponent %T made illegal move %v in %v: %w",
+					opp, mv, gm, err)
+			}
+			replay = append(replay, mv)
+			gm = next
+			continue
+		}
+		mv, next, moved, err := m.play(gm, learn, m.drawBead)
+		if err != nil {
+			return game.Empty, replay, err
+		}
+		if !moved {
+			// MENACE resigned.
+			if learn {
+				m.Punish(mvs)
+			}
+			return menaceSide.Other(), replay, nil
+		}
+		mvs[gm] = mv
+		replay = append(replay, mv)
+		gm = next
+	}
+	outcome := m.ClassifyOutcome(gm, menaceSide, false)
+	if !learn {
+		return outcome.Winner, replay, nil
+	}
+	switch {
+	case outcome.MenaceWon:
+		m.Reward(mvs, true)
+	case outcome.Draw:
+		m.Reward(mvs, false)
+	default:
+		m.Punish(mvs)
+	}
+	return outcome.Winner, replay, nil
+}
+
+// SelfPlayOutcomeDistribution plays games of MENACE against itself without
+// learning, and counts how many were won by X, won by O, or drawn. A resignation
+// counts as a win for the other player. A well-trained MENACE should almost
+// always draw.
+//
+// MENACE is left unchanged. If Options.Seed is set, the games are drawn from
+// a new source seeded with it, so that the counts are the same every time.
+func (m Menace) SelfPlayOutcomeDistribution(games int) (x, o, draws int) {
+	m.rng = newRand(m.options.Seed)
+	for range games {
+		gm := game.New()
+		for !gm.Completed() {
+			_, next, moved, err := m.play(gm, false, m.drawBead)
+			if err != nil {
+				panic(fmt.Sprint("self-play failure: ", err))
+			}
+			if !moved {
+				break
+			}
+			gm = next
+		}
+		// If the game isn't over, the player to move resigned.
+		switch m.ClassifyOutcome(gm, gm.Turn(), !gm.Completed()).Winner {
+		case game.X:
+			x++
+		case game.O:
+			o++
+		default:
+			draws++
+		}
+	}
+	return x, o, draws
+}
+
+// FirstMoveAdvantage measures how much going first helps in MENACE's own play,
+// as X's win rate minus O's win rate over games of MENACE against itself,
+// played as in SelfPlayOutcomeDistribution. It ranges from -1 to 1, and
+// approaches 0 as MENACE learns to draw every game. Returns 0 for no games.
+func (m Menace) FirstMoveAdvantage(games int) float64 {
+	if games <= 0 {
+		return 0
+	}
+	x, o, _ := m.SelfPlayOutcomeDistribution(games)
+	return float64(x-o) / float64(games)
+}